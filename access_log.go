@@ -0,0 +1,191 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	ACCESS_LOG_FORMAT_COMMON      = "common"
+	ACCESS_LOG_FORMAT_COMBINED    = "combined"
+	ACCESS_LOG_FORMAT_COMBINED_ID = "combined_id" // combined followed by the quoted request id
+	ACCESS_LOG_FORMAT_JSON        = "json"
+)
+
+// AccessLogEntry is a line of the json access log format.
+type AccessLogEntry struct {
+	Time      string  `json:"Time"`
+	RequestId string  `json:"RequestId"`
+	RemoteIp  string  `json:"RemoteIp"`
+	Host      string  `json:"Host"`
+	Method    string  `json:"Method"`
+	URI       string  `json:"URI"`
+	Proto     string  `json:"Proto"`
+	Status    int     `json:"Status"`
+	Bytes     int64   `json:"Bytes"`
+	Referer   string  `json:"Referer"`
+	UserAgent string  `json:"UserAgent"`
+	ElapsedMs float64 `json:"ElapsedMs"`
+}
+
+// AccessLogger formats one line per request and hands it to a background
+// goroutine which writes it to a RotateFile, the file is reopened on
+// SIGHUP.
+type AccessLogger struct {
+	Format string
+
+	out      RotateFile
+	mu       sync.RWMutex
+	isClosed bool
+	lineChan chan []byte
+	sigChan  chan os.Signal
+	doneChan chan struct{}
+}
+
+func (p *AccessLogger) Init(options Options) error {
+	var err error
+
+	p.Format = options.AccessLogFormat
+	err = p.out.Init(options.AccessLogPath,
+		options.AccessLogRotateSize<<20,
+		options.AccessLogRotateDuration,
+		options.AccessLogCompress)
+	if err != nil {
+		return err
+	}
+
+	p.isClosed = false
+	p.lineChan = make(chan []byte, options.AccessLogBufferSize)
+	p.doneChan = make(chan struct{})
+	p.sigChan = make(chan os.Signal, 1)
+	signal.Notify(p.sigChan, syscall.SIGHUP)
+
+	go p.loop()
+
+	return nil
+}
+
+func (p *AccessLogger) loop() {
+	defer close(p.doneChan)
+	for {
+		select {
+		case line, ok := <-p.lineChan:
+			if !ok {
+				return
+			}
+			if _, err := p.out.Write(line); err != nil {
+				log.Println("access log write error, err:", err)
+			}
+
+		case <-p.sigChan:
+			if err := p.out.Reopen(); err != nil {
+				log.Println("access log reopen error, err:", err)
+			}
+		}
+	}
+}
+
+// Log queues the access log line of ir, it only blocks when the queue
+// is full.
+func (p *AccessLogger) Log(ir *Request) {
+	var line = p.FormatLine(ir)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.isClosed {
+		return
+	}
+	p.lineChan <- line
+}
+
+// FormatLine renders the access log line of ir in p.Format.
+func (p *AccessLogger) FormatLine(ir *Request) []byte {
+	var (
+		r      = ir.R
+		status = ir.Status()
+		buf    bytes.Buffer
+	)
+
+	if status == 0 {
+		// net/http sends 200 when the handler wrote nothing.
+		status = http.StatusOK
+	}
+
+	if p.Format == ACCESS_LOG_FORMAT_JSON {
+		var entry = AccessLogEntry{
+			Time:      ir.StartAt.Format(time.RFC3339),
+			RequestId: ir.Id,
+			RemoteIp:  ir.RemoteIp,
+			Host:      r.Host,
+			Method:    r.Method,
+			URI:       r.RequestURI,
+			Proto:     r.Proto,
+			Status:    status,
+			Bytes:     ir.BytesWritten(),
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+			ElapsedMs: float64(ir.Elapsed().Microseconds()) / 1000,
+		}
+		res, _ := json.Marshal(entry)
+		buf.Write(res)
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+
+	var user = "-"
+	if name, _, ok := r.BasicAuth(); ok && name != "" {
+		user = name
+	}
+
+	fmt.Fprintf(&buf, "%s - %s [%s] %s %d %d",
+		ir.RemoteIp,
+		user,
+		ir.StartAt.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(r.Method+" "+r.RequestURI+" "+r.Proto),
+		status,
+		ir.BytesWritten())
+
+	if p.Format == ACCESS_LOG_FORMAT_COMBINED || p.Format == ACCESS_LOG_FORMAT_COMBINED_ID {
+		fmt.Fprintf(&buf, " %s %s",
+			strconv.Quote(accessLogField(r.Referer())), strconv.Quote(accessLogField(r.UserAgent())))
+	}
+	if p.Format == ACCESS_LOG_FORMAT_COMBINED_ID {
+		fmt.Fprintf(&buf, " %s", strconv.Quote(ir.Id))
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// accessLogField returns value, or "-" when it is empty as Apache does.
+func accessLogField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Close flushes the queued lines and closes the file.
+func (p *AccessLogger) Close() error {
+	p.mu.Lock()
+	if p.isClosed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.isClosed = true
+	close(p.lineChan)
+	p.mu.Unlock()
+
+	signal.Stop(p.sigChan)
+	<-p.doneChan
+	return p.out.Close()
+}
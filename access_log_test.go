@@ -0,0 +1,69 @@
+package iron
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogFormats(t *testing.T) {
+	var r = httptest.NewRequest("GET", "/a?b=1", nil)
+	r.Header.Set("User-Agent", "iron-test")
+	var ir Request
+	ir.Init(httptest.NewRecorder(), r)
+	ir.Id = "req-1"
+	ir.W.Write([]byte("hello"))
+
+	var logger = AccessLogger{Format: ACCESS_LOG_FORMAT_COMBINED}
+	var line = string(logger.FormatLine(&ir))
+	assert.True(t, strings.HasPrefix(line, "192.0.2.1 - - ["))
+	assert.True(t, strings.HasSuffix(line, `] "GET /a?b=1 HTTP/1.1" 200 5 "-" "iron-test"`+"\n"))
+
+	logger.Format = ACCESS_LOG_FORMAT_COMBINED_ID
+	line = string(logger.FormatLine(&ir))
+	assert.True(t, strings.HasSuffix(line, `] "GET /a?b=1 HTTP/1.1" 200 5 "-" "iron-test" "req-1"`+"\n"))
+
+	logger.Format = ACCESS_LOG_FORMAT_JSON
+	var entry AccessLogEntry
+	assert.NoError(t, json.Unmarshal(logger.FormatLine(&ir), &entry))
+	assert.Equal(t, "/a?b=1", entry.URI)
+	assert.Equal(t, "req-1", entry.RequestId)
+	assert.Equal(t, 200, entry.Status)
+	assert.Equal(t, int64(5), entry.Bytes)
+}
+
+func TestAccessLogRotate(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "iron-access-log")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var options Options
+	options.AccessLogPath = filepath.Join(dir, "access.log")
+	options.AccessLogFormat = ACCESS_LOG_FORMAT_COMMON
+	options.AccessLogCompress = true
+	options.AccessLogBufferSize = 16
+
+	var logger AccessLogger
+	assert.NoError(t, logger.Init(options))
+	logger.out.MaxSize = 100
+
+	for i := 0; i < 3; i++ {
+		var ir Request
+		ir.Init(httptest.NewRecorder(), httptest.NewRequest("GET", "/rotate", nil))
+		logger.Log(&ir)
+	}
+	assert.NoError(t, logger.Close())
+
+	gzFiles, _ := filepath.Glob(options.AccessLogPath + ".*.gz")
+	assert.Equal(t, 2, len(gzFiles))
+
+	content, err := ioutil.ReadFile(options.AccessLogPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "/rotate"))
+}
@@ -0,0 +1,210 @@
+package iron
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ipTrie is a binary trie over the 128 bits of IPv6 addresses, IPv4 is
+// stored in its IPv4-mapped form, so lookups cost at most 128 steps
+// whatever the number of ranges.
+type ipTrie struct {
+	root ipTrieNode
+	size int
+}
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	isLeaf   bool
+}
+
+func (p *ipTrie) insert(ipNet *net.IPNet) {
+	var (
+		ip         = ipNet.IP.To16()
+		ones, bits = ipNet.Mask.Size()
+		node       = &p.root
+	)
+	if bits == 8*net.IPv4len {
+		ones += 8 * (net.IPv6len - net.IPv4len)
+	}
+
+	p.size++
+	for i := 0; i < ones; i++ {
+		if node.isLeaf {
+			// already covered by a wider range
+			return
+		}
+		var b = ip[i/8] >> (7 - uint(i%8)) & 1
+		if node.children[b] == nil {
+			node.children[b] = &ipTrieNode{}
+		}
+		node = node.children[b]
+	}
+	node.isLeaf = true
+	node.children = [2]*ipTrieNode{}
+}
+
+func (p *ipTrie) contains(ip net.IP) bool {
+	if ip = ip.To16(); ip == nil {
+		return false
+	}
+	var node = &p.root
+	for i := 0; i < 8*net.IPv6len; i++ {
+		if node.isLeaf {
+			return true
+		}
+		node = node.children[ip[i/8]>>(7-uint(i%8))&1]
+		if node == nil {
+			return false
+		}
+	}
+	return node.isLeaf
+}
+
+// AccessList is a precompiled allow/deny list of CIDR ranges and IPs.
+// Deny wins over allow, and an empty allow list allows everybody not
+// denied.
+type AccessList struct {
+	allow ipTrie
+	deny  ipTrie
+}
+
+// NewAccessList compiles comma separated allow and deny lists of CIDR
+// ranges and single IPv4 or IPv6 addresses.
+func NewAccessList(allowStr, denyStr string) (*AccessList, error) {
+	var ret = &AccessList{}
+	for _, item := range []struct {
+		str  string
+		trie *ipTrie
+	}{{allowStr, &ret.allow}, {denyStr, &ret.deny}} {
+		var ipNets, err = ParseIpNets(item.str)
+		if err != nil {
+			return nil, err
+		}
+		for _, ipNet := range ipNets {
+			item.trie.insert(ipNet)
+		}
+	}
+	return ret, nil
+}
+
+func (p *AccessList) IsAllowed(ip string) bool {
+	var parsed = net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	if p.deny.contains(parsed) {
+		return false
+	}
+	return p.allow.size == 0 || p.allow.contains(parsed)
+}
+
+// AccessControl maps URL path prefixes to AccessLists, a prefix matching
+// on a path segment boundary, "/admin" covers "/admin" and "/admin/users"
+// but not "/administrator", and "" every path. The deny lists of every
+// matching prefix apply, then the allow list of the longest matching
+// prefix which has one, so a prefix only denying keeps the allow list of
+// the prefixes above it. Lists can be replaced at runtime, readers see an
+// immutable snapshot and never lock.
+type AccessControl struct {
+	mu       sync.Mutex
+	snapshot atomic.Value // []accessRule sorted by prefix length desc
+}
+
+type accessRule struct {
+	prefix string
+	list   *AccessList
+}
+
+// Set compiles and installs the lists for prefix, "" applies to every
+// path. It replaces any lists previously set for prefix.
+func (p *AccessControl) Set(prefix, allowStr, denyStr string) error {
+	var list, err = NewAccessList(allowStr, denyStr)
+	if err != nil {
+		return err
+	}
+	p.update(prefix, list)
+	return nil
+}
+
+// Remove drops the lists set for prefix.
+func (p *AccessControl) Remove(prefix string) {
+	p.update(prefix, nil)
+}
+
+func (p *AccessControl) update(prefix string, list *AccessList) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var rules []accessRule
+	for _, rule := range p.rules() {
+		if rule.prefix != prefix {
+			rules = append(rules, rule)
+		}
+	}
+	if list != nil {
+		rules = append(rules, accessRule{prefix, list})
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].prefix) > len(rules[j].prefix)
+	})
+	p.snapshot.Store(rules)
+}
+
+func (p *AccessControl) rules() []accessRule {
+	rules, _ := p.snapshot.Load().([]accessRule)
+	return rules
+}
+
+// IsAllowed reports whether ip may access path.
+func (p *AccessControl) IsAllowed(path, ip string) bool {
+	var parsed = net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	var allow *ipTrie
+	for _, rule := range p.rules() {
+		if !isPathPrefix(path, rule.prefix) {
+			continue
+		}
+		if rule.list.deny.contains(parsed) {
+			return false
+		}
+		if allow == nil && rule.list.allow.size > 0 {
+			allow = &rule.list.allow
+		}
+	}
+	return allow == nil || allow.contains(parsed)
+}
+
+// isPathPrefix reports whether prefix is path or a parent of it.
+func isPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || prefix == "" ||
+		prefix[len(prefix)-1] == '/' || path[len(prefix)] == '/'
+}
+
+// HookAccessControlRequest answers 403 to clients refused by
+// Server.AccessControl.
+func (p *Server) HookAccessControlRequest(ir *Request) bool {
+	if p.AccessControl.IsAllowed(ir.R.URL.Path, ir.RemoteIp) {
+		return true
+	}
+
+	ir.ApiOutputWithStatus(http.StatusForbidden, nil, CODE_ERR, "forbidden")
+	return false
+}
+
+// HookAccessWhiteListRequest is the former name of HookAccessControlRequest.
+//
+// Deprecated: use HookAccessControlRequest.
+func (p *Server) HookAccessWhiteListRequest(ir *Request) bool {
+	return p.HookAccessControlRequest(ir)
+}
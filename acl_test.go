@@ -0,0 +1,92 @@
+package iron
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessList(t *testing.T) {
+	var list, err = NewAccessList("10.0.0.0/8, 192.168.1.1, 2001:db8::/32", "10.1.0.0/16")
+	assert.NoError(t, err)
+
+	assert.True(t, list.IsAllowed("10.2.3.4"))
+	assert.True(t, list.IsAllowed("192.168.1.1"))
+	assert.True(t, list.IsAllowed("2001:db8:1::5"))
+	assert.False(t, list.IsAllowed("10.1.2.3"))
+	assert.False(t, list.IsAllowed("192.168.1.2"))
+	assert.False(t, list.IsAllowed("2001:db9::1"))
+	assert.False(t, list.IsAllowed("not-an-ip"))
+
+	list, err = NewAccessList("", "0.0.0.0/0")
+	assert.NoError(t, err)
+	assert.False(t, list.IsAllowed("8.8.8.8"))
+	assert.True(t, list.IsAllowed("::1"))
+
+	_, err = NewAccessList("192.168.*", "")
+	assert.Error(t, err)
+}
+
+func TestHookAccessControlRequest(t *testing.T) {
+	var server Server
+	AssertErrIsNil(server.Init(Options{AccessBlackListStr: "192.0.2.0/24"}))
+	server.Router("/", func(ir *Request) {
+		ir.W.Write([]byte("ok"))
+	})
+
+	var serve = func(remoteAddr, path string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		var r = httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = remoteAddr
+		server.httpMux.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve("192.0.2.1:1", "/").Code)
+	assert.Equal(t, `{"Code":-1,"Error":"forbidden","Data":null}`, serve("192.0.2.1:1", "/").Body.String())
+	assert.Equal(t, "ok", serve("198.51.100.1:1", "/").Body.String())
+
+	assert.NoError(t, server.AccessControl.Set("/admin", "127.0.0.1", ""))
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.1:1", "/admin/a").Code)
+	assert.Equal(t, "ok", serve("127.0.0.1:1", "/admin/a").Body.String())
+	assert.Equal(t, "ok", serve("198.51.100.1:1", "/public").Body.String())
+	assert.Equal(t, "ok", serve("198.51.100.1:1", "/administrator").Body.String())
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.1:1", "/admin").Code)
+
+	// the global deny list wins over a more specific allow list
+	assert.NoError(t, server.AccessControl.Set("/admin", "192.0.2.0/24", ""))
+	assert.Equal(t, http.StatusForbidden, serve("192.0.2.1:1", "/admin/a").Code)
+
+	// a prefix only denying keeps the global allow list
+	assert.NoError(t, server.AccessControl.Set("", "10.0.0.0/8", ""))
+	assert.NoError(t, server.AccessControl.Set("/api", "", "10.1.2.3"))
+	assert.Equal(t, http.StatusForbidden, serve("8.8.8.8:1", "/api/x").Code)
+	assert.Equal(t, http.StatusForbidden, serve("10.1.2.3:1", "/api/x").Code)
+	assert.Equal(t, "ok", serve("10.1.2.4:1", "/api/x").Body.String())
+	assert.Equal(t, "ok", serve("10.1.2.3:1", "/public").Body.String())
+	assert.NoError(t, server.AccessControl.Set("", "", "192.0.2.0/24"))
+	server.AccessControl.Remove("/api")
+
+	server.AccessControl.Remove("/admin")
+	assert.Equal(t, "ok", serve("198.51.100.1:1", "/admin/a").Body.String())
+}
+
+func TestIsPathPrefix(t *testing.T) {
+	for _, item := range []struct {
+		path, prefix string
+		isPrefix     bool
+	}{
+		{"/admin", "", true},
+		{"/admin", "/admin", true},
+		{"/admin/users", "/admin", true},
+		{"/admin/users", "/admin/", true},
+		{"/administrator", "/admin", false},
+		{"/admin", "/admin/", false},
+		{"/", "/", true},
+		{"/a", "/", true},
+	} {
+		assert.Equal(t, item.isPrefix, isPathPrefix(item.path, item.prefix), "%+v", item)
+	}
+}
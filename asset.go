@@ -0,0 +1,226 @@
+package iron
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ASSET_HASH_LEN      = 12
+	ASSET_CACHE_CONTROL = "public, max-age=31536000, immutable"
+)
+
+// assetFingerprintRegexp matches name.<hash>.ext and name.<hash>.
+var assetFingerprintRegexp = regexp.MustCompile(`^(.*)\.([0-9a-f]{12})(\.[^./]*)?$`)
+
+// assetHashes caches the content hashes of the static files of
+// Server.staticFS. There is no file watcher: in dev RunMode each use
+// checks the file size and modification time and rehashes a changed
+// file, other modes keep the hash computed at startup.
+type assetHashes struct {
+	mu      sync.RWMutex
+	entries map[string]assetEntry
+}
+
+type assetEntry struct {
+	hash    string
+	size    int64
+	modTime time.Time
+}
+
+// assetHash is the fingerprint of the static file name.
+func (p *Server) assetHash(name string) (string, error) {
+	var fsys = p.staticFS()
+
+	p.assets.mu.RLock()
+	var entry, ok = p.assets.entries[name]
+	p.assets.mu.RUnlock()
+	if ok && p.Options.RunMode != "dev" {
+		return entry.hash, nil
+	}
+
+	var info, err = fs.Stat(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.hash, nil
+	}
+
+	var f fs.File
+	if f, err = fsys.Open(name); err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var h = sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	entry = assetEntry{hex.EncodeToString(h.Sum(nil))[:ASSET_HASH_LEN], info.Size(), info.ModTime()}
+	p.assets.mu.Lock()
+	if p.assets.entries == nil {
+		p.assets.entries = make(map[string]assetEntry)
+	}
+	p.assets.entries[name] = entry
+	p.assets.mu.Unlock()
+	return entry.hash, nil
+}
+
+// AssetName is the fingerprinted name of the static file name, e.g.
+// css/site.css gives css/site.3f2a9c1b0d4e.css.
+func (p *Server) AssetName(name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	var hash, err = p.assetHash(name)
+	if err != nil {
+		return "", err
+	}
+	var ext = path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext, nil
+}
+
+// AssetUrl is the fingerprinted URL of the static file name, served with
+// immutable caching, or its plain URL when it can not be read.
+func (p *Server) AssetUrl(name string) string {
+	var prefix = p.assetUrlPrefix()
+	if hashed, err := p.AssetName(name); err == nil {
+		return prefix + "/" + hashed
+	}
+	return path.Join(prefix, "/", name)
+}
+
+// assetUrlPrefix is the prefix of the static mount serving staticFS.
+func (p *Server) assetUrlPrefix() string {
+	var mux = p.httpMux
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	for _, mount := range mux.statics {
+		if mount.fsys == nil {
+			return mount.prefix
+		}
+	}
+	return "/static"
+}
+
+// resolveAsset maps a fingerprinted name back to the static file it was
+// computed from, it reports false when name is not one or the hash is
+// stale.
+func (p *Server) resolveAsset(fsys fs.FS, name string) (string, bool) {
+	var m = assetFingerprintRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return "", false
+	}
+	if _, err := fs.Stat(fsys, name); err == nil {
+		// a real file which looks fingerprinted
+		return "", false
+	}
+	var original = m[1] + m[3]
+	if hash, err := p.assetHash(original); err != nil || hash != m[2] {
+		return "", false
+	}
+	return original, true
+}
+
+// LoadAssets hashes every static file now rather than on first use,
+// hidden files, precompressed siblings and the upload dir when it lies
+// below the static root are skipped. Serve calls it when a static root is
+// set, a missing root or unreadable file fails the start.
+func (p *Server) LoadAssets() error {
+	var (
+		fsys      = p.staticFS()
+		uploadDir = p.uploadAssetDir()
+	)
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == uploadDir {
+			return fs.SkipDir
+		}
+		if name != "." && isHiddenPath(name) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || isPrecompressedSibling(fsys, name) {
+			return nil
+		}
+		_, err = p.assetHash(name)
+		return err
+	})
+}
+
+// uploadAssetDir is the name of SiteStaticUploadBasePath in staticFS, ""
+// when it does not lie below SiteStaticBasePath. Uploads are hashed on
+// first use only, there may be many of them.
+func (p *Server) uploadAssetDir() string {
+	var staticDir, uploadDir = p.Options.SiteStaticBasePath, p.Options.SiteStaticUploadBasePath
+	if staticDir == "" || uploadDir == "" {
+		return ""
+	}
+
+	var err error
+	if staticDir, err = filepath.Abs(staticDir); err != nil {
+		return ""
+	}
+	if uploadDir, err = filepath.Abs(uploadDir); err != nil {
+		return ""
+	}
+	var rel string
+	if rel, err = filepath.Rel(staticDir, uploadDir); err != nil ||
+		rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func isPrecompressedSibling(fsys fs.FS, name string) bool {
+	for _, item := range staticEncodings {
+		if strings.HasSuffix(name, item.ext) {
+			if _, err := fs.Stat(fsys, strings.TrimSuffix(name, item.ext)); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AssetManifest maps the static files hashed so far to their fingerprinted
+// names, call LoadAssets first to get all of them.
+func (p *Server) AssetManifest() map[string]string {
+	p.assets.mu.RLock()
+	var names = make([]string, 0, len(p.assets.entries))
+	for name := range p.assets.entries {
+		names = append(names, name)
+	}
+	p.assets.mu.RUnlock()
+
+	var ret = make(map[string]string)
+	for _, name := range names {
+		if hashed, err := p.AssetName(name); err == nil {
+			ret[name] = hashed
+		}
+	}
+	return ret
+}
+
+// WriteAssetManifest writes AssetManifest as json to filename, for
+// deploy tools and CDN uploads.
+func (p *Server) WriteAssetManifest(filename string) error {
+	var res, err = json.MarshalIndent(p.AssetManifest(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, res, 0644)
+}
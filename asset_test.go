@@ -0,0 +1,76 @@
+package iron
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsset(t *testing.T) {
+	var staticDir, err = ioutil.TempDir("", "iron-asset")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(staticDir)
+	AssertErrIsNil(os.MkdirAll(filepath.Join(staticDir, "css"), 0755))
+	var cssFile = filepath.Join(staticDir, "css", "site.css")
+	AssertErrIsNil(ioutil.WriteFile(cssFile, []byte("body{}"), 0644))
+	AssertErrIsNil(ioutil.WriteFile(cssFile+".gz", []byte("gzipped"), 0644))
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(staticDir, ".secret"), []byte("secret"), 0644))
+	AssertErrIsNil(os.MkdirAll(filepath.Join(staticDir, "upload"), 0755))
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(staticDir, "upload", "a.png"), []byte("png"), 0644))
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{
+		RunMode:                  "dev",
+		SiteStaticBasePath:       staticDir,
+		SiteStaticUploadBasePath: filepath.Join(staticDir, "upload"),
+	}))
+
+	var serve = func(path string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	var url = server.AssetUrl("css/site.css")
+	assert.Regexp(t, `^/static/css/site\.[0-9a-f]{12}\.css$`, url)
+	assert.Equal(t, "/static/missing.js", server.AssetUrl("missing.js"))
+
+	var w = serve(url)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "body{}", w.Body.String())
+	assert.Equal(t, ASSET_CACHE_CONTROL, w.Header().Get("Cache-Control"))
+
+	w = serve("/static/css/site.css")
+	assert.Equal(t, "body{}", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Cache-Control"))
+
+	// dev RunMode notices the change
+	AssertErrIsNil(ioutil.WriteFile(cssFile, []byte("body{color:red}"), 0644))
+	var modTime = time.Now().Add(time.Second)
+	AssertErrIsNil(os.Chtimes(cssFile, modTime, modTime))
+	var newUrl = server.AssetUrl("css/site.css")
+	assert.NotEqual(t, url, newUrl)
+	assert.Equal(t, `{"Code":-1,"Error":"command not found","Data":null}`, serve(url).Body.String())
+	assert.Equal(t, "body{color:red}", serve(newUrl).Body.String())
+
+	// uploads are left to be hashed on use
+	AssertErrIsNil(server.LoadAssets())
+	var manifest = server.AssetManifest()
+	assert.Equal(t, 1, len(manifest))
+	assert.Equal(t, strings.TrimPrefix(newUrl, "/static/"), manifest["css/site.css"])
+
+	var manifestFile = filepath.Join(staticDir, "manifest.json")
+	AssertErrIsNil(server.WriteAssetManifest(manifestFile))
+	var res, _ = ioutil.ReadFile(manifestFile)
+	var loaded map[string]string
+	AssertErrIsNil(json.Unmarshal(res, &loaded))
+	assert.Equal(t, manifest, loaded)
+}
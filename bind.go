@@ -0,0 +1,238 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	fileHeaderType    = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderArrType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+// bindTimeLayouts are the layouts a time.Time field is parsed with, in
+// order. Layouts without a zone are taken as UTC.
+var bindTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Bind fills dst, a pointer to struct, from the request then validates it
+// with Validate. Sources are applied in order, later ones overriding:
+//
+//   - the json body, through encoding/json and `json` tags
+//   - query, form and multipart values, through `form` tags
+//   - path params, through `param` tags
+//
+// A field without `form` tag is bound by its json name, then by its Go
+// name; `form:"-"` skips it. *multipart.FileHeader and
+// []*multipart.FileHeader fields receive uploaded files. time.Time fields
+// take RFC 3339 values, or the layouts of html date and datetime-local
+// inputs.
+//
+// The json body is read up to Options.BindMaxBodySize MB. Conversion and
+// validation failures are returned as ValidationErrors.
+func (p *Request) Bind(dst interface{}) error {
+	var v = reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ErrBindDstNotValid
+	}
+
+	var mediaType, _, _ = mime.ParseMediaType(p.R.Header.Get("Content-Type"))
+	if mediaType == "application/json" && p.R.Body != nil {
+		var maxBodySize int64 = 1
+		if p.server != nil {
+			maxBodySize = p.server.Options.BindMaxBodySize
+		}
+		var body, err = ioutil.ReadAll(http.MaxBytesReader(p.W, p.R.Body, maxBodySize<<20))
+		if err != nil {
+			return xerrors.Errorf("%w %v", ErrCmdParamInvalid, err)
+		}
+		p.R.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err = json.Unmarshal(body, dst); err != nil {
+				return xerrors.Errorf("%w %v", ErrCmdParamInvalid, err)
+			}
+		}
+	}
+
+	p.prepareForm()
+
+	var files map[string][]*multipart.FileHeader
+	if p.R.MultipartForm != nil {
+		files = p.R.MultipartForm.File
+	}
+
+	var errs ValidationErrors
+	bindStruct(v.Elem(), p, files, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return Validate(dst)
+}
+
+func bindStruct(v reflect.Value, ir *Request, files map[string][]*multipart.FileHeader, errs *ValidationErrors) {
+	var t = v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		var (
+			sf    = t.Field(i)
+			field = v.Field(i)
+		)
+
+		if sf.Anonymous && field.Kind() == reflect.Struct {
+			bindStruct(field, ir, files, errs)
+			continue
+		}
+		if sf.PkgPath != "" || !field.CanSet() {
+			continue
+		}
+
+		if name, ok := sf.Tag.Lookup("param"); ok && name != "-" {
+			if value, ok := ir.Params.Get(name); ok {
+				if err := bindValue(field, []string{value}); err != nil {
+					*errs = append(*errs, FieldError{name, "type", err.Error()})
+				}
+			}
+			continue
+		}
+
+		var name = bindFieldName(sf)
+		if name == "-" {
+			continue
+		}
+
+		switch sf.Type {
+		case fileHeaderType:
+			if len(files[name]) > 0 {
+				field.Set(reflect.ValueOf(files[name][0]))
+			}
+			continue
+		case fileHeaderArrType:
+			if len(files[name]) > 0 {
+				field.Set(reflect.ValueOf(files[name]))
+			}
+			continue
+		}
+
+		var values = ir.R.Form[name]
+		if len(values) == 0 {
+			continue
+		}
+		if err := bindValue(field, values); err != nil {
+			*errs = append(*errs, FieldError{name, "type", err.Error()})
+		}
+	}
+}
+
+// bindFieldName returns the name a struct field is bound and reported by.
+func bindFieldName(sf reflect.StructField) string {
+	if name, ok := sf.Tag.Lookup("form"); ok && name != "" {
+		return name
+	}
+	if name := strings.Split(sf.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
+
+func bindValue(v reflect.Value, values []string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		var elem = reflect.New(v.Type().Elem())
+		if err := bindValue(elem.Elem(), values); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+
+	case reflect.Slice:
+		var arr = reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i := range values {
+			if err := bindValue(arr.Index(i), values[i:i+1]); err != nil {
+				return err
+			}
+		}
+		v.Set(arr)
+		return nil
+	}
+
+	return bindScalar(v, strings.TrimSpace(values[0]))
+}
+
+func bindScalar(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+
+	case reflect.Bool:
+		if value == "on" {
+			value = "true"
+		}
+		var ret, err = strconv.ParseBool(value)
+		if err != nil {
+			return xerrors.New("not bool")
+		}
+		v.SetBool(ret)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			var ret, err = time.ParseDuration(value)
+			if err != nil {
+				return xerrors.New("not duration")
+			}
+			v.SetInt(int64(ret))
+			return nil
+		}
+		var ret, err = strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return xerrors.New("not int")
+		}
+		v.SetInt(ret)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var ret, err = strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return xerrors.New("not uint")
+		}
+		v.SetUint(ret)
+
+	case reflect.Float32, reflect.Float64:
+		var ret, err = strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return xerrors.New("not float")
+		}
+		v.SetFloat(ret)
+
+	case reflect.Struct:
+		if v.Type() != timeType {
+			return xerrors.Errorf("unsupported type %s", v.Type())
+		}
+		for _, layout := range bindTimeLayouts {
+			if ret, err := time.Parse(layout, value); err == nil {
+				v.Set(reflect.ValueOf(ret))
+				return nil
+			}
+		}
+		return xerrors.New("not time")
+
+	default:
+		return xerrors.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package iron
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+type bindTestReq struct {
+	Id     int64                 `param:"id"`
+	Name   string                `form:"name" validate:"required,min=2,max=8"`
+	Email  string                `json:"email" validate:"omitempty,email"`
+	Age    *int                  `form:"age" validate:"min=18"`
+	Kind   string                `form:"kind" validate:"oneof=a b"`
+	Tags   []string              `form:"tag"`
+	Code   string                `form:"code" validate:"omitempty,regexp=^[a-z]{2,3}$"`
+	Avatar *multipart.FileHeader `form:"avatar"`
+	Born   time.Time             `form:"born"`
+	Since  *time.Time            `form:"since"`
+}
+
+func TestRequestBindForm(t *testing.T) {
+	var body bytes.Buffer
+	var mw = multipart.NewWriter(&body)
+	mw.WriteField("name", " iron ")
+	mw.WriteField("email", "iron@example.com")
+	mw.WriteField("age", "20")
+	mw.WriteField("tag", "x")
+	mw.WriteField("tag", "y")
+	mw.WriteField("born", "2000-01-02")
+	mw.WriteField("since", "2020-03-04T05:06:07+08:00")
+	fw, _ := mw.CreateFormFile("avatar", "a.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+
+	var r = httptest.NewRequest("POST", "/user/42?kind=b&code=ab", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	var ir Request
+	ir.Init(httptest.NewRecorder(), r)
+	ir.Params = Params{{"id", "42"}}
+
+	var req bindTestReq
+	assert.NoError(t, ir.Bind(&req))
+	assert.Equal(t, int64(42), req.Id)
+	assert.Equal(t, "iron", req.Name)
+	assert.Equal(t, "iron@example.com", req.Email)
+	assert.Equal(t, 20, *req.Age)
+	assert.Equal(t, "b", req.Kind)
+	assert.Equal(t, []string{"x", "y"}, req.Tags)
+	assert.Equal(t, "a.png", req.Avatar.Filename)
+	assert.Equal(t, time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC), req.Born)
+	assert.Equal(t, int64(1583269567), req.Since.Unix())
+}
+
+func TestRequestBindJSONValidate(t *testing.T) {
+	var r = httptest.NewRequest("POST", "/?age=abc&kind=c&code=a1",
+		strings.NewReader(`{"name":"i","email":"nope"}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	var w = httptest.NewRecorder()
+	var ir Request
+	ir.Init(w, r)
+
+	var req bindTestReq
+	var err = ir.Bind(&req)
+	assert.Equal(t, ValidationErrors{{"age", "type", "not int"}}, err)
+
+	r = httptest.NewRequest("POST", "/?born=yesterday", nil)
+	ir.Init(w, r)
+	err = ir.Bind(&bindTestReq{})
+	assert.Equal(t, ValidationErrors{{"born", "type", "not time"}}, err)
+
+	r = httptest.NewRequest("POST", "/?kind=c&code=a1",
+		strings.NewReader(`{"name":"i","email":"nope"}`))
+	r.Header.Set("Content-Type", "application/json")
+	ir.Init(w, r)
+	err = ir.Bind(&req)
+	assert.Equal(t, ValidationErrors{
+		{"name", "min", "length must be at least 2"},
+		{"email", "email", "must be a valid email"},
+		{"kind", "oneof", "must be one of a b"},
+		{"code", "regexp", "must match ^[a-z]{2,3}$"},
+	}, err)
+
+	ir.ApiOutputError(err)
+	assert.True(t, strings.HasPrefix(w.Body.String(),
+		`{"Code":-1,"Error":"name length must be at least 2; email must be a valid email;`))
+	assert.True(t, strings.Contains(w.Body.String(),
+		`"Data":[{"Field":"name","Rule":"min","Message":"length must be at least 2"},`))
+
+	assert.Equal(t, ValidationErrors{
+		{"name", "required", "is required"},
+		{"kind", "oneof", "must be one of a b"},
+	}, Validate(&bindTestReq{}))
+
+	// zero values are checked unless omitempty comes first
+	var zero struct {
+		Age     int    `validate:"min=18"`
+		Count   int    `validate:"omitempty,min=1"`
+		Comment string `validate:"omitempty,max=2"`
+	}
+	assert.Equal(t, ValidationErrors{{"Age", "min", "must be at least 18"}}, Validate(&zero))
+}
+
+func TestRequestBindBodyLimit(t *testing.T) {
+	var server Server
+	AssertErrIsNil(server.Init(Options{BindMaxBodySize: 1}))
+	var r = httptest.NewRequest("POST", "/",
+		strings.NewReader(`{"name":"`+strings.Repeat("a", 1<<20)+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	var ir = Request{server: &server}
+	ir.Init(httptest.NewRecorder(), r)
+
+	var err = ir.Bind(&bindTestReq{})
+	assert.True(t, xerrors.Is(err, ErrCmdParamInvalid), "%v", err)
+}
+
+func TestValidateTagInvalid(t *testing.T) {
+	for _, dst := range []interface{}{
+		&struct {
+			Name string `validate:"requird"`
+		}{},
+		&struct {
+			Age int `validate:"min=ten"`
+		}{},
+		&struct {
+			Inner struct {
+				Code string `validate:"regexp=[a-"`
+			}
+		}{},
+	} {
+		var err = Validate(dst)
+		assert.True(t, xerrors.Is(err, ErrValidateTagInvalid), "%v", err)
+		// the cached result is reported again
+		assert.Equal(t, err, Validate(dst))
+	}
+}
@@ -0,0 +1,149 @@
+package iron
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	CLIENT_IP_HEADER_X_FORWARDED_FOR = "X-Forwarded-For"
+	CLIENT_IP_HEADER_FORWARDED       = "Forwarded"
+	CLIENT_IP_HEADER_X_REAL_IP       = "X-Real-IP"
+)
+
+// ParseIpNets parses a comma separated list of CIDR ranges and single
+// IPv4 or IPv6 addresses, single addresses become /32 or /128 ranges.
+func ParseIpNets(str string) ([]*net.IPNet, error) {
+	var ret []*net.IPNet
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		var ipNet, err = ParseIpNet(item)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ipNet)
+	}
+	return ret, nil
+}
+
+// ParseIpNet parses a CIDR range or a single IPv4 or IPv6 address.
+func ParseIpNet(str string) (*net.IPNet, error) {
+	if strings.Contains(str, "/") {
+		var _, ipNet, err = net.ParseCIDR(str)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid CIDR %s", str)
+		}
+		return ipNet, nil
+	}
+
+	var ip = net.ParseIP(str)
+	if ip == nil {
+		return nil, xerrors.Errorf("invalid IP %s", str)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// RemoteAddrIp returns the IP part of a http.Request.RemoteAddr, it
+// handles IPv6 addresses such as [::1]:8080.
+func RemoteAddrIp(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return strings.Trim(remoteAddr, "[]")
+}
+
+// IsTrustedProxy reports whether ip is in Options.TrustedProxies.
+func (p *Server) IsTrustedProxy(ip string) bool {
+	if len(p.Options.TrustedProxies) == 0 {
+		return false
+	}
+	var parsed = net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range p.Options.TrustedProxies {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIp returns the IP of the client which sent r. Only the
+// Options.ClientIpHeader header is honoured, and only when the peer is a
+// trusted proxy. Forwarding chains are walked from the right, skipping
+// trusted hops, so a client cannot spoof its address through that header,
+// and headers the proxy does not set are never read.
+func (p *Server) ClientIp(r *http.Request) string {
+	var remoteIp = RemoteAddrIp(r.RemoteAddr)
+	if !p.IsTrustedProxy(remoteIp) {
+		return remoteIp
+	}
+
+	var chain []string
+	switch p.Options.ClientIpHeader {
+	case CLIENT_IP_HEADER_FORWARDED:
+		chain = parseForwardedFor(r.Header.Values("Forwarded"))
+	case CLIENT_IP_HEADER_X_REAL_IP:
+		if realIp := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIp) != nil {
+			return realIp
+		}
+	default:
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			for _, item := range strings.Split(value, ",") {
+				chain = append(chain, strings.TrimSpace(item))
+			}
+		}
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		var ip = normalizeForwardedIp(chain[i])
+		if ip == "" {
+			// unknown or obfuscated hop, nothing left to trust
+			break
+		}
+		if !p.IsTrustedProxy(ip) || i == 0 {
+			return ip
+		}
+	}
+
+	return remoteIp
+}
+
+// parseForwardedFor returns the for= values of RFC 7239 Forwarded headers.
+func parseForwardedFor(values []string) []string {
+	var ret []string
+	for _, value := range values {
+		for _, elem := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				var kv = strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					ret = append(ret, strings.Trim(kv[1], `"`))
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// normalizeForwardedIp strips the port and brackets of a forwarded hop,
+// returning "" when it is not an IP.
+func normalizeForwardedIp(hop string) string {
+	hop = strings.TrimSpace(hop)
+	if net.ParseIP(hop) != nil {
+		return hop
+	}
+	var ip = RemoteAddrIp(hop)
+	if net.ParseIP(ip) != nil {
+		return ip
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package iron
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerClientIp(t *testing.T) {
+	var server Server
+	AssertErrIsNil(server.Init(Options{TrustedProxiesStr: "127.0.0.1, 10.0.0.0/8, ::1"}))
+
+	var clientIp = func(remoteAddr string, headers ...string) string {
+		var r = httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		for i := 0; i < len(headers); i += 2 {
+			r.Header.Add(headers[i], headers[i+1])
+		}
+		return server.ClientIp(r)
+	}
+
+	assert.Equal(t, "203.0.113.7", clientIp("203.0.113.7:1234"))
+	assert.Equal(t, "2001:db8::1", clientIp("[2001:db8::1]:1234"))
+	assert.Equal(t, "203.0.113.7", clientIp("203.0.113.7:1234", "X-Forwarded-For", "1.2.3.4"))
+	assert.Equal(t, "198.51.100.9",
+		clientIp("127.0.0.1:1234", "X-Forwarded-For", "1.2.3.4, 198.51.100.9, 10.1.2.3"))
+	// the proxy sets X-Forwarded-For, a Forwarded or X-Real-IP the client sent is ignored
+	assert.Equal(t, "198.51.100.9", clientIp("127.0.0.1:1234",
+		"Forwarded", "for=1.2.3.4", "X-Real-IP", "1.2.3.4", "X-Forwarded-For", "198.51.100.9"))
+	assert.Equal(t, "127.0.0.1", clientIp("127.0.0.1:1234", "Forwarded", "for=1.2.3.4"))
+
+	AssertErrIsNil(server.Init(Options{TrustedProxiesStr: "127.0.0.1, ::1", ClientIpHeader: "forwarded"}))
+	assert.Equal(t, CLIENT_IP_HEADER_FORWARDED, server.Options.ClientIpHeader)
+	assert.Equal(t, "2001:db8::2",
+		clientIp("[::1]:1234", "Forwarded", `for="[2001:db8::2]:4711";proto=https, for=::1`))
+	assert.Equal(t, "127.0.0.1", clientIp("127.0.0.1:1234", "Forwarded", "for=unknown"))
+	assert.Equal(t, "127.0.0.1", clientIp("127.0.0.1:1234", "X-Forwarded-For", "1.2.3.4"))
+
+	AssertErrIsNil(server.Init(Options{TrustedProxiesStr: "127.0.0.1", ClientIpHeader: "X-Real-IP"}))
+	assert.Equal(t, "1.2.3.4", clientIp("127.0.0.1:1234", "X-Real-IP", "1.2.3.4"))
+	assert.Equal(t, "127.0.0.1", clientIp("127.0.0.1:1234", "X-Forwarded-For", "1.2.3.4"))
+
+	var err = server.Init(Options{TrustedProxiesStr: "10.0.0.0/33"})
+	assert.Error(t, err)
+	err = server.Init(Options{ClientIpHeader: "X-Client-IP"})
+	assert.Error(t, err)
+}
@@ -4,4 +4,6 @@ const (
 	CODE_OK  = 0
 	CODE_ERR = -1
 	CODE_404 = 404
+
+	CODE_TIMEOUT = -2
 )
@@ -0,0 +1,277 @@
+package iron
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	COMPRESS_TYPES_DEFAULT     = "text/,application/json,application/javascript,application/xml,image/svg+xml"
+	COMPRESS_ENCODINGS_DEFAULT = "br,gzip,deflate"
+	COMPRESS_MIN_SIZE_DEFAULT  = 1024
+)
+
+// compressEncoder is what the pooled gzip, flate and brotli writers share.
+type compressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var compressors = map[string]*sync.Pool{
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(nil, 4)
+	}},
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	"deflate": {New: func() interface{} {
+		var w, _ = flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}},
+}
+
+// wrapCompress makes ir.W compress the response when Options.IsCompress,
+// with the first of Options.CompressEncodings the client accepts. Paths
+// with an extension of Server.ImgExts are left alone. When the client
+// accepts none the response is still wrapped, uncompressed, so Vary is
+// set on the same responses whatever the client accepts.
+func (p *Server) wrapCompress(ir *Request) {
+	if !p.Options.IsCompress || ir.R.Method == http.MethodHead {
+		return
+	}
+
+	var ext = strings.ToLower(strings.TrimPrefix(path.Ext(ir.R.URL.Path), "."))
+	for _, imgExt := range p.ImgExts {
+		if ext == imgExt {
+			return
+		}
+	}
+
+	var inner = ir.ResponseWriter()
+	if inner == nil {
+		return
+	}
+
+	var (
+		acceptEncoding = ir.R.Header.Get("Accept-Encoding")
+		selected       string
+	)
+	for _, encoding := range p.Options.CompressEncodings {
+		if acceptsEncoding(acceptEncoding, encoding) {
+			selected = encoding
+			break
+		}
+	}
+
+	ir.compress = &compressWriter{
+		ResponseWriter: inner,
+		encoding:       selected,
+		minSize:        *p.Options.CompressMinSize,
+		types:          p.Options.CompressTypes,
+	}
+	ir.W = exposeCapabilities(ir.compress, inner)
+}
+
+// closeCompress flushes and releases the encoder of ir.W, if any.
+func closeCompress(ir *Request) {
+	if ir.compress != nil {
+		ir.compress.Close()
+	}
+}
+
+// addVary adds value to the Vary header unless already listed.
+func addVary(header http.Header, value string) {
+	for _, line := range header.Values("Vary") {
+		for _, item := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
+
+// compressWriter buffers the start of the body until it knows whether to
+// compress it: the status and Content-Type allow it, the body is not
+// encoded already and reaches minSize, or is flushed. Such an eligible
+// response gets Vary: Accept-Encoding, and is sent as is when encoding is
+// empty.
+type compressWriter struct {
+	ResponseWriter
+	encoding string
+	minSize  int
+	types    []string
+
+	status    int
+	buf       []byte
+	isDecided bool
+	encoder   compressEncoder
+}
+
+func (p *compressWriter) WriteHeader(status int) {
+	if p.isDecided {
+		p.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		p.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if p.status == 0 {
+		p.status = status
+	}
+}
+
+func (p *compressWriter) Write(b []byte) (int, error) {
+	if p.isDecided {
+		if p.encoder != nil {
+			return p.encoder.Write(b)
+		}
+		return p.ResponseWriter.Write(b)
+	}
+
+	if p.status == 0 {
+		p.status = http.StatusOK
+	}
+	p.buf = append(p.buf, b...)
+	if len(p.buf) >= p.minSize {
+		if err := p.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (p *compressWriter) readFrom(src io.Reader) (int64, error) {
+	// plain copy, the ReaderFrom of the inner writer would skip us
+	return io.Copy(struct{ io.Writer }{p}, src)
+}
+
+// decide sends the headers and the buffered body, compressed when allowed
+// and isBigEnough.
+func (p *compressWriter) decide(isBigEnough bool) error {
+	p.isDecided = true
+
+	var header = p.Header()
+	if p.status == 0 {
+		p.status = http.StatusOK
+	}
+	if header.Get("Content-Type") == "" && len(p.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(p.buf))
+	}
+
+	var isEligible = p.isTypeAllowed(header.Get("Content-Type")) &&
+		p.status != http.StatusNoContent && p.status != http.StatusPartialContent &&
+		header.Get("Content-Encoding") == "" && header.Get("Content-Range") == ""
+	if isEligible && (isBigEnough || p.status == http.StatusNotModified) {
+		// a 304 carries the Vary of the response it stands for
+		addVary(header, "Accept-Encoding")
+	}
+	if isEligible && isBigEnough && p.status != http.StatusNotModified && p.encoding != "" {
+		header.Set("Content-Encoding", p.encoding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		p.encoder = compressors[p.encoding].Get().(compressEncoder)
+		p.encoder.Reset(p.ResponseWriter)
+	}
+
+	p.ResponseWriter.WriteHeader(p.status)
+	if len(p.buf) == 0 {
+		return nil
+	}
+	var buf = p.buf
+	p.buf = nil
+	if p.encoder != nil {
+		_, err := p.encoder.Write(buf)
+		return err
+	}
+	_, err := p.ResponseWriter.Write(buf)
+	return err
+}
+
+func (p *compressWriter) isTypeAllowed(contentType string) bool {
+	for _, prefix := range p.types {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// flush sends what is buffered, compressing it whatever its size, the
+// response is likely streamed.
+func (p *compressWriter) flush() {
+	if !p.isDecided {
+		p.decide(true)
+	}
+	if p.encoder != nil {
+		p.encoder.Flush()
+	}
+	if f, ok := p.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close ends the compressed stream and puts the encoder back in its pool.
+func (p *compressWriter) Close() error {
+	if !p.isDecided {
+		if p.status == 0 && len(p.buf) == 0 {
+			// nothing written, net/http answers 200 with an empty body
+			return nil
+		}
+		if err := p.decide(len(p.buf) >= p.minSize); err != nil {
+			return err
+		}
+	}
+	if p.encoder == nil {
+		return nil
+	}
+	var err = p.encoder.Close()
+	p.encoder.Reset(nil)
+	compressors[p.encoding].Put(p.encoder)
+	p.encoder = nil
+	return err
+}
+
+func (p *compressWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	var h, ok = p.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	p.isDecided = true
+	return h.Hijack()
+}
+
+func (p *compressWriter) push(target string, opts *http.PushOptions) error {
+	if pusher, ok := p.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (p *compressWriter) Status() int {
+	if !p.isDecided {
+		return p.status
+	}
+	return p.ResponseWriter.Status()
+}
+
+func (p *compressWriter) IsHeaderWritten() bool {
+	return p.status != 0 || p.ResponseWriter.IsHeaderWritten()
+}
+
+func (p *compressWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
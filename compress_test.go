@@ -0,0 +1,137 @@
+package iron
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	var big = strings.Repeat("iron compress ", 200)
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "proc", IsCompress: true}))
+	server.Static("/assets", fstest.MapFS{
+		"logo.png": {Data: []byte(big)},
+		"app.js":   {Data: []byte(big)},
+	}, StaticOptions{})
+	server.Router("/big", func(ir *Request) {
+		ir.ApiOutputSuccess(big)
+	})
+	server.Router("/small", func(ir *Request) {
+		ir.ApiOutputSuccess("small")
+	})
+	server.Router("/binary", func(ir *Request) {
+		ir.W.Header().Set("Content-Type", "application/octet-stream")
+		ir.W.Write([]byte(big))
+	})
+	server.Router("/stream", func(ir *Request) {
+		ir.W.Header().Set("Content-Type", "text/plain")
+		ir.W.Write([]byte("first"))
+		ir.W.(http.Flusher).Flush()
+		ir.W.Write([]byte(" second"))
+	})
+
+	var serve = func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		var r = httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		server.httpMux.ServeHTTP(w, r)
+		return w
+	}
+	var decode = func(w *httptest.ResponseRecorder) string {
+		var r io.Reader = w.Body
+		switch w.Header().Get("Content-Encoding") {
+		case "gzip":
+			var err error
+			r, err = gzip.NewReader(r)
+			AssertErrIsNil(err)
+		case "deflate":
+			r = flate.NewReader(r)
+		case "br":
+			r = brotli.NewReader(r)
+		}
+		var res, err = ioutil.ReadAll(r)
+		AssertErrIsNil(err)
+		return string(res)
+	}
+
+	for _, item := range []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"gzip, deflate, br", "br"},
+		{"gzip, deflate", "gzip"},
+		{"deflate", "deflate"},
+		{"br;q=0, gzip", "gzip"},
+		{"", ""},
+	} {
+		// twice so pooled encoders get reused
+		for i := 0; i < 2; i++ {
+			var w = serve("/big", item.acceptEncoding)
+			assert.Equal(t, item.encoding, w.Header().Get("Content-Encoding"), item.acceptEncoding)
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			assert.Equal(t, `{"Code":0,"Error":"success","Data":"`+big+`"}`, decode(w))
+			if item.encoding != "" {
+				assert.True(t, w.Body.Len() < len(big))
+			}
+		}
+	}
+
+	var w = serve("/small", "gzip")
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "", w.Header().Get("Vary"))
+	assert.Equal(t, `{"Code":0,"Error":"success","Data":"small"}`, w.Body.String())
+
+	for _, acceptEncoding := range []string{"gzip", ""} {
+		w = serve("/binary", acceptEncoding)
+		assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "", w.Header().Get("Vary"))
+		assert.Equal(t, big, w.Body.String())
+	}
+
+	w = serve("/assets/logo.png", "gzip")
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, big, w.Body.String())
+
+	w = serve("/assets/app.js", "gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "", w.Header().Get("Content-Length"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("ETag"), `W/"`))
+	assert.Equal(t, big, decode(w))
+
+	w = serve("/stream", "gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "first second", decode(w))
+}
+
+func TestCompressMinSize(t *testing.T) {
+	var minSize = 0
+	var server Server
+	AssertErrIsNil(server.Init(Options{IsCompress: true, CompressMinSize: &minSize}))
+	server.Router("/small", func(ir *Request) {
+		ir.ApiOutputSuccess("small")
+	})
+
+	var w = httptest.NewRecorder()
+	var r = httptest.NewRequest("GET", "/small", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	server.httpMux.ServeHTTP(w, r)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+	AssertErrIsNil(server.Init(Options{IsCompress: true}))
+	assert.Equal(t, COMPRESS_MIN_SIZE_DEFAULT, *server.Options.CompressMinSize)
+
+	minSize = -1
+	assert.Error(t, server.Init(Options{IsCompress: true, CompressMinSize: &minSize}))
+}
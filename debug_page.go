@@ -0,0 +1,176 @@
+package iron
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DebugPage is what the dev RunMode error page shows about a failure.
+type DebugPage struct {
+	Status   int
+	Title    string
+	Error    string
+	Stack    string
+	Source   []DebugSourceLine
+	File     string
+	Line     int
+	Request  *http.Request
+	Id       string
+	RemoteIp string
+	Headers  [][2]string
+	Form     [][2]string
+	V        [][2]string
+	ViewData [][2]string
+}
+
+type DebugSourceLine struct {
+	Number    int
+	Code      string
+	IsCurrent bool
+}
+
+var (
+	debugTemplateErrRegexp = regexp.MustCompile(`template: ([^:\s]+):(\d+):`)
+	debugStackFileRegexp   = regexp.MustCompile(`^\t(.+\.go):(\d+)`)
+)
+
+// RenderDebugPage writes the development error page of err: the stack,
+// the source around where it happened, and the request with its form,
+// V and ViewData.
+func (p *Request) RenderDebugPage(status int, err interface{}, stack []byte) {
+	var page = DebugPage{
+		Status:   status,
+		Title:    http.StatusText(status),
+		Error:    fmt.Sprint(err),
+		Stack:    string(stack),
+		Request:  p.R,
+		Id:       p.Id,
+		RemoteIp: p.RemoteIp,
+	}
+
+	page.File, page.Line = p.debugLocation(page.Error, page.Stack)
+	if page.File != "" {
+		page.Source = debugSourceLines(page.File, page.Line, 5)
+	}
+
+	for k, v := range p.R.Header {
+		page.Headers = append(page.Headers, [2]string{k, strings.Join(v, ", ")})
+	}
+	if p.R.Form == nil {
+		p.R.ParseForm()
+	}
+	for k, v := range p.R.Form {
+		page.Form = append(page.Form, [2]string{k, strings.Join(v, ", ")})
+	}
+	for k, v := range p.V {
+		page.V = append(page.V, [2]string{k, fmt.Sprintf("%+v", v)})
+	}
+	for k, v := range p.ViewData {
+		page.ViewData = append(page.ViewData, [2]string{k, fmt.Sprintf("%+v", v)})
+	}
+	for _, arr := range [][][2]string{page.Headers, page.Form, page.V, page.ViewData} {
+		sort.Slice(arr, func(i, j int) bool { return arr[i][0] < arr[j][0] })
+	}
+
+	p.W.Header().Set("Content-Type", "text/html;charset=utf-8")
+	p.W.Header().Set("Server", "iron")
+	p.W.WriteHeader(status)
+	debugPageTemplate.Execute(p.W, page)
+}
+
+// debugLocation finds the file and line the failure comes from, the
+// template for template errors, else the frame which panicked.
+func (p *Request) debugLocation(errStr, stack string) (string, int) {
+	if m := debugTemplateErrRegexp.FindStringSubmatch(errStr); m != nil && p.server != nil {
+		var line, _ = strconv.Atoi(m[2])
+		var file = m[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(p.server.Options.SiteViewDir, file)
+		}
+		return file, line
+	}
+
+	var (
+		lines     = strings.Split(stack, "\n")
+		isInPanic = false
+	)
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") {
+			isInPanic = true
+			continue
+		}
+		if !isInPanic || i == 0 {
+			continue
+		}
+		var m = debugStackFileRegexp.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(lines[i-1], "runtime.") || strings.HasPrefix(lines[i-1], "panic(") {
+			continue
+		}
+		var number, _ = strconv.Atoi(m[2])
+		return m[1], number
+	}
+	return "", 0
+}
+
+func debugSourceLines(file string, line, around int) []DebugSourceLine {
+	var f, err = os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var (
+		ret     []DebugSourceLine
+		scanner = bufio.NewScanner(f)
+	)
+	for number := 1; scanner.Scan(); number++ {
+		if number < line-around {
+			continue
+		}
+		if number > line+around {
+			break
+		}
+		ret = append(ret, DebugSourceLine{number, scanner.Text(), number == line})
+	}
+	return ret
+}
+
+var debugPageTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Status}} {{.Title}}</title>
+<style>
+body{font-family:sans-serif;margin:2em;color:#222}
+h1{color:#b00}
+pre{background:#f6f6f6;padding:1em;overflow:auto}
+table{border-collapse:collapse;margin-bottom:1.5em}
+td{border:1px solid #ddd;padding:.2em .6em;vertical-align:top;font-family:monospace}
+.current{background:#fdd}
+</style></head><body>
+<h1>{{.Status}} {{.Title}}</h1>
+<pre>{{.Error}}</pre>
+{{if .Source}}<h2>{{.File}}:{{.Line}}</h2>
+<table>{{range .Source}}<tr{{if .IsCurrent}} class="current"{{end}}><td>{{.Number}}</td><td><pre style="margin:0;padding:0;background:none">{{.Code}}</pre></td></tr>{{end}}</table>{{end}}
+<h2>Request</h2>
+<table>
+<tr><td>Id</td><td>{{.Id}}</td></tr>
+<tr><td>Method</td><td>{{.Request.Method}}</td></tr>
+<tr><td>URL</td><td>{{.Request.URL}}</td></tr>
+<tr><td>Proto</td><td>{{.Request.Proto}}</td></tr>
+<tr><td>RemoteIp</td><td>{{.RemoteIp}}</td></tr>
+</table>
+{{define "kv"}}<table>{{range .}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>{{else}}<tr><td>empty</td></tr>{{end}}</table>{{end}}
+<h2>Headers</h2>{{template "kv" .Headers}}
+<h2>Form</h2>{{template "kv" .Form}}
+<h2>V</h2>{{template "kv" .V}}
+<h2>ViewData</h2>{{template "kv" .ViewData}}
+<h2>Stack</h2>
+<pre>{{.Stack}}</pre>
+</body></html>
+`))
@@ -7,4 +7,26 @@ var (
 	ErrCmdParamInvalid   = xerrors.New("command params invalid.")
 	ErrCmdParamEmpty     = xerrors.New("command params empty.")
 	ErrRespIsNotRespData = xerrors.New("resp is not IRespData")
+	ErrTimeout           = xerrors.New("timeout.")
+	ErrBindDstNotValid   = xerrors.New("bind dst should be a non nil pointer to struct.")
+	ErrViewNotFound      = xerrors.New("view not found.")
+
+	ErrValidateTagInvalid = xerrors.New("validate tag invalid.")
+
+	ErrUploadInvalid        = xerrors.New("upload invalid.")
+	ErrUploadMissing        = xerrors.New("upload missing.")
+	ErrUploadTooMany        = xerrors.New("upload has too many files.")
+	ErrUploadTooLarge       = xerrors.New("upload too large.")
+	ErrUploadExtNotAllowed  = xerrors.New("upload extension not allowed.")
+	ErrUploadTypeNotAllowed = xerrors.New("upload type not allowed.")
+	ErrUploadNameInvalid    = xerrors.New("upload name invalid.")
+
+	ErrImageFormatNotSupported = xerrors.New("image format not supported.")
+	ErrImageTooLarge           = xerrors.New("image too large.")
+	ErrImageOptionsInvalid     = xerrors.New("image options invalid.")
+
+	ErrSessionNotFound      = xerrors.New("session not found.")
+	ErrSessionInvalid       = xerrors.New("session invalid.")
+	ErrSessionTooLarge      = xerrors.New("session too large.")
+	ErrSessionSecretMissing = xerrors.New("session secret missing.")
 )
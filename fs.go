@@ -0,0 +1,77 @@
+package iron
+
+import (
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// overlayFS reads from upper and falls back to lower, directories list
+// the entries of both.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (p overlayFS) Open(name string) (fs.File, error) {
+	var f, err = p.upper.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	return p.lower.Open(name)
+}
+
+func (p overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var (
+		upper, upperErr = fs.ReadDir(p.upper, name)
+		lower, lowerErr = fs.ReadDir(p.lower, name)
+	)
+	if upperErr != nil && lowerErr != nil {
+		return nil, upperErr
+	}
+
+	var (
+		ret   = upper
+		names = make(map[string]bool)
+	)
+	for _, entry := range upper {
+		names[entry.Name()] = true
+	}
+	for _, entry := range lower {
+		if !names[entry.Name()] {
+			ret = append(ret, entry)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name() < ret[j].Name() })
+	return ret, nil
+}
+
+// layeredFS is the filesystem of dir: fsys when set, overridden by dir
+// on disk in dev RunMode.
+func (p *Server) layeredFS(fsys fs.FS, dir string) fs.FS {
+	if dir == "" {
+		// os.DirFS("") fails every Open, an unset dir is the working
+		// directory as with the paths of the os package
+		dir = "."
+	}
+	var disk = os.DirFS(dir)
+	if fsys == nil {
+		return disk
+	}
+	if p.Options.RunMode == "dev" {
+		return overlayFS{disk, fsys}
+	}
+	return fsys
+}
+
+// viewFS is where views, layouts and partials are read from, ViewFS or
+// SiteViewDir.
+func (p *Server) viewFS() fs.FS {
+	return p.layeredFS(p.ViewFS, p.Options.SiteViewDir)
+}
+
+// staticFS is where static files are read from, StaticFS or
+// SiteStaticBasePath.
+func (p *Server) staticFS() fs.FS {
+	return p.layeredFS(p.StaticFS, p.Options.SiteStaticBasePath)
+}
@@ -0,0 +1,69 @@
+package iron
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerFS(t *testing.T) {
+	var diskDir, err = ioutil.TempDir("", "iron-fs")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(diskDir)
+	AssertErrIsNil(os.MkdirAll(filepath.Join(diskDir, "view", "partial"), 0755))
+	AssertErrIsNil(os.MkdirAll(filepath.Join(diskDir, "static"), 0755))
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(diskDir, "view", "partial", "name.html"),
+		[]byte(`<? define "name" ?>disk<? end ?>`), 0644))
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(diskDir, "static", "app.js"), []byte("disk js"), 0644))
+
+	var embedded = fstest.MapFS{
+		"view/index.html":        {Data: []byte(`<? define "Frame" ?><? template "name" ?>/<? template "footer" ?><? end ?>`)},
+		"view/partial/name.html": {Data: []byte(`<? define "name" ?>embedded<? end ?>`)},
+		"view/partial/foot.html": {Data: []byte(`<? define "footer" ?>footer<? end ?>`)},
+		"static/app.js":          {Data: []byte("embedded js")},
+		"static/app.css":         {Data: []byte("embedded css")},
+	}
+
+	for _, runMode := range []string{"dev", "proc"} {
+		var server Server
+		AssertErrIsNil(server.Init(Options{
+			RunMode:            runMode,
+			SiteViewDir:        filepath.Join(diskDir, "view"),
+			SiteStaticBasePath: filepath.Join(diskDir, "static"),
+		}))
+		server.ViewFS, _ = fs.Sub(embedded, "view")
+		server.StaticFS, _ = fs.Sub(embedded, "static")
+		server.AssignView("index", "index.html")
+		server.Router("/", func(ir *Request) {
+			ir.Render("index")
+		})
+
+		var source = "embedded"
+		if runMode == "dev" {
+			source = "disk"
+		}
+
+		var w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/index", nil))
+		assert.Equal(t, source+"/footer", w.Body.String())
+
+		w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/static/app.js", nil))
+		assert.Equal(t, source+" js", w.Body.String())
+
+		w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/static/app.css", nil))
+		assert.Equal(t, "embedded css", w.Body.String())
+
+		w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/static/../view/index.html", nil))
+		assert.NotEqual(t, http.StatusOK, w.Code)
+	}
+}
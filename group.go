@@ -0,0 +1,109 @@
+package iron
+
+// RouterGroup registers routes under a shared path prefix, and runs its
+// own before/after hooks (then those of its parents) around them only.
+type RouterGroup struct {
+	server      *Server
+	parent      *RouterGroup
+	prefix      string
+	beforeHooks []func(*Request) bool
+	afterHooks  []func(*Request) bool
+}
+
+// Group returns a RouterGroup whose routes are prefixed with prefix and
+// guarded by beforeHooks, a hook returning false stops the request.
+func (p *Server) Group(prefix string, beforeHooks ...func(*Request) bool) *RouterGroup {
+	return &RouterGroup{
+		server:      p,
+		prefix:      prefix,
+		beforeHooks: beforeHooks,
+	}
+}
+
+// Group returns a nested RouterGroup, it inherits the prefix and hooks of p.
+func (p *RouterGroup) Group(prefix string, beforeHooks ...func(*Request) bool) *RouterGroup {
+	return &RouterGroup{
+		server:      p.server,
+		parent:      p,
+		prefix:      p.prefix + prefix,
+		beforeHooks: beforeHooks,
+	}
+}
+
+// Prefix returns the full path prefix of the group.
+func (p *RouterGroup) Prefix() string {
+	return p.prefix
+}
+
+func (p *RouterGroup) HookBeforeHttpHandle(hookFunc func(*Request) bool) {
+	p.beforeHooks = append(p.beforeHooks, hookFunc)
+}
+
+func (p *RouterGroup) HookAfterHttpHandle(hookFunc func(*Request) bool) {
+	p.afterHooks = append(p.afterHooks, hookFunc)
+}
+
+func (p *RouterGroup) Router(path string, handler func(*Request)) {
+	p.server.Router(p.prefix+path, p.wrap(handler))
+}
+
+func (p *RouterGroup) RouterMethod(method, path string, handler func(*Request)) {
+	p.server.RouterMethod(method, p.prefix+path, p.wrap(handler))
+}
+
+func (p *RouterGroup) GET(path string, handler func(*Request)) {
+	p.server.GET(p.prefix+path, p.wrap(handler))
+}
+
+func (p *RouterGroup) POST(path string, handler func(*Request)) {
+	p.server.POST(p.prefix+path, p.wrap(handler))
+}
+
+func (p *RouterGroup) PUT(path string, handler func(*Request)) {
+	p.server.PUT(p.prefix+path, p.wrap(handler))
+}
+
+func (p *RouterGroup) DELETE(path string, handler func(*Request)) {
+	p.server.DELETE(p.prefix+path, p.wrap(handler))
+}
+
+func (p *RouterGroup) PATCH(path string, handler func(*Request)) {
+	p.server.PATCH(p.prefix+path, p.wrap(handler))
+}
+
+// wrap runs the hooks of the group chain around handler, outermost group
+// first for before hooks and last for after hooks. Hooks are read at
+// request time so hooks added after a route still apply to it.
+func (p *RouterGroup) wrap(handler func(*Request)) func(*Request) {
+	return func(ir *Request) {
+		if !p.runBeforeHooks(ir) {
+			return
+		}
+		handler(ir)
+		p.runAfterHooks(ir)
+	}
+}
+
+func (p *RouterGroup) runBeforeHooks(ir *Request) bool {
+	if p.parent != nil && !p.parent.runBeforeHooks(ir) {
+		return false
+	}
+	for _, h := range p.beforeHooks {
+		if !h(ir) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *RouterGroup) runAfterHooks(ir *Request) bool {
+	for _, h := range p.afterHooks {
+		if !h(ir) {
+			return false
+		}
+	}
+	if p.parent != nil {
+		return p.parent.runAfterHooks(ir)
+	}
+	return true
+}
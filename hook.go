@@ -22,12 +22,15 @@ type HookAfterHttpHandle struct {
 
 type HookUrlRewrite func(*Request) bool
 
+type HookShutdown func()
+
 type Hook struct {
 	BeforeServeRequest []HookBeforeServeRequest
 	BeforeHttpHandles  []HookBeforeHttpHandle
 	ErrorRecovers      []HookErrorRecover
 	AfterHttpHandles   []HookAfterHttpHandle
 	UrlRewrite         []HookUrlRewrite
+	Shutdowns          []HookShutdown
 }
 
 func (p *Server) HookBeforeServeRequest(matchPrefix string, hookFunc func(*Request) bool, excludePrefix ...string) {
@@ -60,6 +63,19 @@ func (p *Server) HookAfterHttpHandle(matchPrefix string, hookFunc func(*Request)
 	})
 }
 
+// HookErrorRecover registers a func to run when a handler panics, it runs
+// before the after handle hooks. Every registered func runs, the returned
+// bool is ignored.
+func (p *Server) HookErrorRecover(hookFunc func(*Request, interface{}) bool) {
+	p.Hook.ErrorRecovers = append(p.Hook.ErrorRecovers, hookFunc)
+}
+
+// HookShutdown registers a func to run by Shutdown once in-flight
+// requests have finished.
+func (p *Server) HookShutdown(hookFunc func()) {
+	p.Hook.Shutdowns = append(p.Hook.Shutdowns, hookFunc)
+}
+
 func (mux *ServeMux) IsRequestURIMatchHookBase(ir *Request, hookBase *HookBase) bool {
 	handleMatchPrefixLen := len(hookBase.MatchPrefix)
 	reqURILen := len(ir.R.RequestURI)
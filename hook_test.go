@@ -0,0 +1,49 @@
+package iron
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookAfterHttpHandle(t *testing.T) {
+	var (
+		server       = prepareMuxServer()
+		afterStatus  int
+		afterBytes   int64
+		recoverCount int
+	)
+
+	server.Router("/ok", func(ir *Request) {
+		ir.W.WriteHeader(http.StatusCreated)
+		ir.W.Write([]byte("created"))
+	})
+	server.Router("/panic", func(ir *Request) {
+		panic("boom")
+	})
+	server.HookErrorRecover(func(ir *Request, err interface{}) bool {
+		recoverCount++
+		return true
+	})
+	server.HookAfterHttpHandle("", func(ir *Request) bool {
+		afterStatus = ir.Status()
+		afterBytes = ir.BytesWritten()
+		assert.True(t, ir.Elapsed() > 0)
+		return true
+	})
+
+	serveMuxForTest(server, "", "/ok")
+	assert.Equal(t, http.StatusCreated, afterStatus)
+	assert.Equal(t, int64(len("created")), afterBytes)
+	assert.Equal(t, 0, recoverCount)
+
+	var logWriter = log.Writer()
+	log.SetOutput(ioutil.Discard)
+	serveMuxForTest(server, "", "/panic")
+	log.SetOutput(logWriter)
+	assert.Equal(t, http.StatusInternalServerError, afterStatus)
+	assert.Equal(t, 1, recoverCount)
+}
@@ -2,14 +2,72 @@ package iron
 
 import (
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 )
 
 type muxEntry struct {
 	explicit bool
 	h        Handler
+	methods  map[string]Handler
 	pattern  string
 }
 
+// handler picks the handler registered for method, falling back to the
+// one registered for any method, then to the automatic OPTIONS and 405
+// responses.
+func (e *muxEntry) handler(method string) Handler {
+	if h, ok := e.methods[method]; ok {
+		return h
+	}
+	if e.h != nil {
+		return e.h
+	}
+	if h, ok := e.methods[http.MethodGet]; ok && method == http.MethodHead {
+		return h
+	}
+	if method == http.MethodOptions {
+		return &optionsHandler{e.allow()}
+	}
+	return &methodNotAllowedHandler{e.allow()}
+}
+
+// allow returns the Allow header value for the methods registered on e.
+func (e *muxEntry) allow() string {
+	var methods = []string{http.MethodOptions}
+	for method := range e.methods {
+		methods = append(methods, method)
+	}
+	if _, ok := e.methods[http.MethodGet]; ok {
+		if _, ok = e.methods[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// Answer OPTIONS with the methods registered for the path
+type optionsHandler struct {
+	allow string
+}
+
+func (oh *optionsHandler) TinyironServeHTTP(ir *Request) {
+	ir.W.Header().Set("Allow", oh.allow)
+	ir.W.WriteHeader(http.StatusNoContent)
+}
+
+// Answer 405 when the path matches but the method does not
+type methodNotAllowedHandler struct {
+	allow string
+}
+
+func (mh *methodNotAllowedHandler) TinyironServeHTTP(ir *Request) {
+	ir.W.Header().Set("Allow", mh.allow)
+	ir.ApiOutputWithStatus(http.StatusMethodNotAllowed, nil, CODE_ERR, "method not allowed")
+}
+
 // Redirect to a fixed URL
 type redirectHandler struct {
 	url  string
@@ -20,6 +78,16 @@ func (rh *redirectHandler) TinyironServeHTTP(ir *Request) {
 	http.Redirect(ir.W, ir.R, rh.url, rh.code)
 }
 
+// Redirect to the requested path with a trailing slash
+type trailingSlashRedirectHandler struct {
+	code int
+}
+
+func (rh *trailingSlashRedirectHandler) TinyironServeHTTP(ir *Request) {
+	var target = url.URL{Path: ir.R.URL.Path + "/", RawQuery: ir.R.URL.RawQuery}
+	http.Redirect(ir.W, ir.R, target.String(), rh.code)
+}
+
 // RedirectHandler returns a req handler that redirects
 // each req it receives to the given url using the given
 // status code.
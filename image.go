@@ -0,0 +1,291 @@
+package iron
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/xerrors"
+)
+
+const (
+	IMAGE_MODE_FIT  = "fit"  // within Width x Height keeping the aspect, never enlarged
+	IMAGE_MODE_FILL = "fill" // cropped to the aspect of Width x Height, then resized to it
+
+	IMAGE_MAX_SIZE      = 4096     // of the Width and Height asked
+	IMAGE_MAX_PIXELS    = 40 << 20 // decoded images larger than this are refused
+	IMAGE_QUALITY       = 85       // jpeg quality when ImageOptions.Quality is 0
+	IMAGE_CACHE_CONTROL = "public, max-age=2592000"
+)
+
+// ImageOptions describes an image variant, the zero value re-encodes the
+// image as is, which drops its metadata such as EXIF.
+type ImageOptions struct {
+	Width   int    // 0 follows Height keeping the aspect
+	Height  int    // 0 follows Width keeping the aspect
+	Mode    string // IMAGE_MODE_FIT or IMAGE_MODE_FILL, "" means fit
+	Format  string // jpg, png or gif, "" keeps the source format
+	Quality int    // jpeg quality 1-100, 0 means IMAGE_QUALITY
+}
+
+func (p *ImageOptions) sanitize() error {
+	p.Format = normalizeImageExt(p.Format)
+	if p.Mode == "" {
+		p.Mode = IMAGE_MODE_FIT
+	}
+	if p.Quality == 0 {
+		p.Quality = IMAGE_QUALITY
+	}
+	switch {
+	case p.Width < 0 || p.Width > IMAGE_MAX_SIZE || p.Height < 0 || p.Height > IMAGE_MAX_SIZE:
+		return xerrors.Errorf("%w, size:%dx%d", ErrImageOptionsInvalid, p.Width, p.Height)
+	case p.Mode != IMAGE_MODE_FIT && p.Mode != IMAGE_MODE_FILL:
+		return xerrors.Errorf("%w, mode:%s", ErrImageOptionsInvalid, p.Mode)
+	case p.Format != "" && p.Format != "jpg" && p.Format != "png" && p.Format != "gif":
+		return xerrors.Errorf("%w, format:%s", ErrImageFormatNotSupported, p.Format)
+	case p.Quality < 1 || p.Quality > 100:
+		return xerrors.Errorf("%w, quality:%d", ErrImageOptionsInvalid, p.Quality)
+	}
+	return nil
+}
+
+func normalizeImageExt(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext == "jpeg" {
+		return "jpg"
+	}
+	return ext
+}
+
+// ProcessImage decodes the jpeg, png or gif src, resizes it as options
+// ask and encodes it to dst. It returns the extension of the output.
+func ProcessImage(dst io.Writer, src io.Reader, options ImageOptions) (string, error) {
+	if err := options.sanitize(); err != nil {
+		return "", err
+	}
+
+	var content, err = ioutil.ReadAll(src)
+	if err != nil {
+		return "", err
+	}
+	var (
+		config image.Config
+		format string
+	)
+	if config, format, err = image.DecodeConfig(bytes.NewReader(content)); err != nil {
+		return "", xerrors.Errorf("%w, err:%v", ErrImageFormatNotSupported, err)
+	}
+	if config.Width*config.Height > IMAGE_MAX_PIXELS {
+		return "", xerrors.Errorf("%w, size:%dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+
+	var img image.Image
+	if img, err = imageDecode(format, bytes.NewReader(content)); err != nil {
+		return "", err
+	}
+	img = resizeImage(img, options)
+
+	var ext = options.Format
+	if ext == "" {
+		ext = normalizeImageExt(format)
+	}
+	if ext == "jpg" {
+		img = flattenImage(img)
+	}
+	return ext, imageEncode(ext, dst, img, options.Quality)
+}
+
+func resizeImage(img image.Image, options ImageOptions) image.Image {
+	var (
+		bounds = img.Bounds()
+		w, h   = options.Width, options.Height
+	)
+	if w == 0 && h == 0 {
+		return img
+	}
+
+	if options.Mode == IMAGE_MODE_FILL && w > 0 && h > 0 {
+		img = cropImageToAspect(img, w, h)
+	} else {
+		var scale = math.Inf(1)
+		if w > 0 {
+			scale = float64(w) / float64(bounds.Dx())
+		}
+		if h > 0 {
+			scale = math.Min(scale, float64(h)/float64(bounds.Dy()))
+		}
+		if scale >= 1 {
+			return img
+		}
+		w = int(math.Max(1, math.Round(float64(bounds.Dx())*scale)))
+		h = int(math.Max(1, math.Round(float64(bounds.Dy())*scale)))
+	}
+
+	var dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// cropImageToAspect keeps the center of img with the aspect of w x h.
+func cropImageToAspect(img image.Image, w, h int) image.Image {
+	var (
+		bounds = img.Bounds()
+		cw, ch = bounds.Dx(), bounds.Dy()
+	)
+	if cw*h > ch*w {
+		cw = ch * w / h
+	} else {
+		ch = cw * h / w
+	}
+	var rect = image.Rect(0, 0, cw, ch).
+		Add(bounds.Min).
+		Add(image.Pt((bounds.Dx()-cw)/2, (bounds.Dy()-ch)/2))
+
+	if croppable, ok := img.(ImageCouldCrop); ok {
+		return croppable.SubImage(rect)
+	}
+	var dst = image.NewRGBA(image.Rect(0, 0, cw, ch))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// flattenImage draws img over white, jpeg has no transparency.
+func flattenImage(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	var (
+		bounds = img.Bounds()
+		dst    = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	)
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+	return dst
+}
+
+// ImageServeOptions configures Server.Images. Each variant is processed
+// and cached once, so the variants asked by URL are limited to the listed
+// ones.
+type ImageServeOptions struct {
+	Sizes        []string // allowed "WxH" of the w and h parameters, e.g. "200x0", empty serves the original size only
+	Qualities    []int    // allowed q parameters, empty allows none
+	CacheControl string   // "" means IMAGE_CACHE_CONTROL
+}
+
+// Images serves the images of UploadStorage under prefix, as variants
+// described by the w, h, mode, fmt and q URL parameters, e.g.
+// prefix/avatar/a.jpg?w=200&h=200&mode=fill. Variants are cached in
+// Options.ImageCacheDir, uploads are expected not to change under the
+// same name.
+func (p *Server) Images(prefix string, options ImageServeOptions) {
+	prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+	if options.CacheControl == "" {
+		options.CacheControl = IMAGE_CACHE_CONTROL
+	}
+	p.GET(prefix+"/*name", func(ir *Request) {
+		p.serveImage(ir, options)
+	})
+}
+
+func (p *Server) serveImage(ir *Request, serveOptions ImageServeOptions) {
+	var name, err = CleanUploadName(ir.Param("name"))
+	if err != nil || !StringIsIn(normalizeImageExt(path.Ext(name)), p.imgExts()) {
+		ir.ApiOutputWithStatus(http.StatusNotFound, nil, CODE_ERR, "not found")
+		return
+	}
+
+	var options ImageOptions
+	if options, err = parseImageOptions(ir, serveOptions); err != nil {
+		ir.ApiOutputWithStatus(http.StatusBadRequest, nil, CODE_ERR, err.Error())
+		return
+	}
+
+	var (
+		sum       = sha256.Sum256([]byte(fmt.Sprintf("%s|%+v", name, options)))
+		key       = hex.EncodeToString(sum[:])
+		ext       = options.Format
+		cache     = &LocalUploadStorage{Dir: p.Options.ImageCacheDir}
+		cacheName string
+		content   []byte
+	)
+	if ext == "" {
+		ext = normalizeImageExt(path.Ext(name))
+	}
+	cacheName = key[:2] + "/" + key + "." + ext
+
+	if rc, err := cache.Open(cacheName); err == nil {
+		content, err = ioutil.ReadAll(rc)
+		rc.Close()
+	}
+	if content == nil {
+		var src io.ReadCloser
+		if src, err = p.UploadStorage.Open(name); err != nil {
+			ir.ApiOutputWithStatus(http.StatusNotFound, nil, CODE_ERR, "not found")
+			return
+		}
+		var buf bytes.Buffer
+		_, err = ProcessImage(&buf, src, options)
+		src.Close()
+		if err != nil {
+			ir.ApiOutputWithStatus(http.StatusUnprocessableEntity, nil, CODE_ERR, err.Error())
+			return
+		}
+		content = buf.Bytes()
+		if _, err = cache.Save(cacheName, bytes.NewReader(content)); err != nil {
+			log.Println("request id:", ir.Id, ", image cache save failed, name:", cacheName, ", err:", err)
+		}
+	}
+
+	ir.W.Header().Set("Content-Type", mime.TypeByExtension("."+ext))
+	ir.W.Header().Set("Cache-Control", serveOptions.CacheControl)
+	ir.W.Header().Set("ETag", `"`+key[:32]+`"`)
+	http.ServeContent(ir.W, ir.R, cacheName, time.Time{}, bytes.NewReader(content))
+}
+
+func parseImageOptions(ir *Request, serveOptions ImageServeOptions) (ImageOptions, error) {
+	var (
+		query   = ir.R.URL.Query()
+		options = ImageOptions{Mode: query.Get("mode"), Format: query.Get("fmt")}
+		err     error
+	)
+	for _, item := range []struct {
+		key string
+		ret *int
+	}{{"w", &options.Width}, {"h", &options.Height}, {"q", &options.Quality}} {
+		if str := query.Get(item.key); str != "" {
+			if *item.ret, err = strconv.Atoi(str); err != nil {
+				return options, xerrors.Errorf("%w, %s:%s", ErrImageOptionsInvalid, item.key, str)
+			}
+		}
+	}
+	if (options.Width != 0 || options.Height != 0) &&
+		!StringIsIn(fmt.Sprintf("%dx%d", options.Width, options.Height), serveOptions.Sizes) {
+		return options, xerrors.Errorf("%w, size:%dx%d", ErrImageOptionsInvalid, options.Width, options.Height)
+	}
+	if options.Quality != 0 && !IntIsIn(options.Quality, serveOptions.Qualities) {
+		return options, xerrors.Errorf("%w, quality:%d", ErrImageOptionsInvalid, options.Quality)
+	}
+	return options, options.sanitize()
+}
+
+// imgExts is ImgExts normalized by normalizeImageExt.
+func (p *Server) imgExts() []string {
+	var ret []string
+	for _, ext := range p.ImgExts {
+		ret = append(ret, normalizeImageExt(ext))
+	}
+	return ret
+}
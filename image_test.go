@@ -0,0 +1,191 @@
+package iron
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+func newImageTestPng(w, h int) []byte {
+	var img = image.NewNRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), 0, 128})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestProcessImage(t *testing.T) {
+	var src = newImageTestPng(400, 200)
+
+	for _, item := range []struct {
+		options ImageOptions
+		ext     string
+		w, h    int
+	}{
+		{ImageOptions{}, "png", 400, 200},
+		{ImageOptions{Width: 100}, "png", 100, 50},
+		{ImageOptions{Height: 100}, "png", 200, 100},
+		{ImageOptions{Width: 100, Height: 100}, "png", 100, 50},
+		{ImageOptions{Width: 800}, "png", 400, 200}, // never enlarged
+		{ImageOptions{Width: 100, Height: 100, Mode: IMAGE_MODE_FILL}, "png", 100, 100},
+		{ImageOptions{Width: 90, Height: 30, Mode: IMAGE_MODE_FILL, Format: "jpeg", Quality: 50}, "jpg", 90, 30},
+		{ImageOptions{Format: "gif"}, "gif", 400, 200},
+	} {
+		var buf bytes.Buffer
+		var ext, err = ProcessImage(&buf, bytes.NewReader(src), item.options)
+		assert.Nil(t, err, "%+v", item.options)
+		assert.Equal(t, item.ext, ext)
+		var config, format, _ = image.DecodeConfig(&buf)
+		assert.Equal(t, item.ext, normalizeImageExt(format))
+		assert.Equal(t, item.w, config.Width, "%+v", item.options)
+		assert.Equal(t, item.h, config.Height, "%+v", item.options)
+	}
+
+	var qualities []int
+	for _, quality := range []int{10, 90} {
+		var buf bytes.Buffer
+		_, err := ProcessImage(&buf, bytes.NewReader(src), ImageOptions{Format: "jpg", Quality: quality})
+		assert.Nil(t, err)
+		_, err = jpeg.Decode(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		qualities = append(qualities, buf.Len())
+	}
+	assert.True(t, qualities[0] < qualities[1])
+
+	for _, item := range []struct {
+		src     []byte
+		options ImageOptions
+		err     error
+	}{
+		{src, ImageOptions{Width: IMAGE_MAX_SIZE + 1}, ErrImageOptionsInvalid},
+		{src, ImageOptions{Width: -1}, ErrImageOptionsInvalid},
+		{src, ImageOptions{Mode: "stretch"}, ErrImageOptionsInvalid},
+		{src, ImageOptions{Quality: 101}, ErrImageOptionsInvalid},
+		{src, ImageOptions{Format: "bmp"}, ErrImageFormatNotSupported},
+		{[]byte("<html>"), ImageOptions{}, ErrImageFormatNotSupported},
+	} {
+		var _, err = ProcessImage(ioutil.Discard, bytes.NewReader(item.src), item.options)
+		assert.True(t, xerrors.Is(err, item.err), "%v", err)
+	}
+}
+
+func TestCropImageToAspect(t *testing.T) {
+	var img = image.NewRGBA(image.Rect(10, 10, 410, 210))
+	var cropped = cropImageToAspect(img, 1, 1)
+	assert.Equal(t, image.Rect(110, 10, 310, 210), cropped.Bounds())
+	cropped = cropImageToAspect(img, 4, 1)
+	assert.Equal(t, image.Rect(10, 60, 410, 160), cropped.Bounds())
+}
+
+func TestServerImages(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "iron-image")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(dir)
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "test", ImageCacheDir: dir}))
+	var storage = &MemoryUploadStorage{}
+	server.UploadStorage = storage
+	storage.Save("avatar/a.png", bytes.NewReader(newImageTestPng(400, 200)))
+	storage.Save("doc/a.txt", bytes.NewReader([]byte("text")))
+	server.Images("/img", ImageServeOptions{Sizes: []string{"100x100", "50x0"}, Qualities: []int{50}})
+	server.Images("/orig", ImageServeOptions{})
+
+	var get = func(target string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	// unlisted variants are refused
+	assert.Equal(t, 400, get("/orig/avatar/a.png?w=100&h=100").Code)
+	assert.Equal(t, 400, get("/orig/avatar/a.png?q=50").Code)
+	assert.Equal(t, 400, get("/img/avatar/a.png?w=100&h=100&q=60").Code)
+	assert.Equal(t, 200, get("/img/avatar/a.png?w=100&h=100&q=50").Code)
+	assert.Equal(t, 200, get("/orig/avatar/a.png").Code)
+
+	var w = get("/img/avatar/a.png?w=100&h=100&mode=fill&fmt=jpg")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	assert.Equal(t, IMAGE_CACHE_CONTROL, w.Header().Get("Cache-Control"))
+	var config, format, _ = image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, 100, config.Width)
+	assert.Equal(t, 100, config.Height)
+	var cached, _ = filepath.Glob(filepath.Join(dir, "*", "*.jpg"))
+	assert.Equal(t, 1, len(cached))
+
+	// served from the cache once the source is gone
+	var etag = w.Header().Get("ETag")
+	storage.Remove("avatar/a.png")
+	w = get("/img/avatar/a.png?w=100&h=100&mode=fill&fmt=jpg")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	var r = httptest.NewRequest("GET", "/img/avatar/a.png?w=100&h=100&mode=fill&fmt=jpg", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, r)
+	assert.Equal(t, 304, w.Code)
+
+	assert.Equal(t, 404, get("/img/avatar/a.png?w=50").Code)
+	assert.Equal(t, 400, get("/img/avatar/a.png?w=60").Code)
+	assert.Equal(t, 400, get("/img/avatar/a.png?w=abc").Code)
+	assert.Equal(t, 404, get("/img/doc/a.txt").Code)
+	assert.NotEqual(t, 200, get("/img/../etc/a.png").Code)
+	assert.Equal(t, 404, get("/img/.cache/a.png").Code)
+}
+
+func TestUploadImage(t *testing.T) {
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "test"}))
+	var storage = &MemoryUploadStorage{}
+	server.UploadStorage = storage
+
+	var rule = UploadRule{
+		Exts:  []string{".png"},
+		Dir:   "avatar",
+		Image: &ImageOptions{Width: 64, Height: 64, Mode: IMAGE_MODE_FILL, Format: "jpg"},
+	}
+	var ir = newUploadTestRequest(&server, map[string][][2]string{
+		"avatar": {{"me.png", string(newImageTestPng(400, 200))}},
+	})
+	var file, err = ir.UploadFile("avatar", rule)
+	assert.Nil(t, err)
+	assert.Regexp(t, `^avatar/[0-9a-f]{32}\.jpg$`, file.Name)
+	assert.Equal(t, "image/jpeg", file.MimeType)
+	var rc, _ = storage.Open(file.Name)
+	var content, _ = ioutil.ReadAll(rc)
+	assert.Equal(t, file.Size, int64(len(content)))
+	var config, _, _ = image.DecodeConfig(bytes.NewReader(content))
+	assert.Equal(t, 64, config.Width)
+
+	ir = newUploadTestRequest(&server, map[string][][2]string{
+		"avatar": {{"me.png", string(uploadTestPng)}},
+	})
+	_, err = ir.UploadFile("avatar", rule)
+	assert.True(t, xerrors.Is(err, ErrImageFormatNotSupported), "%v", err)
+	assert.Equal(t, 1, len(storage.files))
+
+	rule.MaxSize = 100
+	ir = newUploadTestRequest(&server, map[string][][2]string{
+		"avatar": {{"me.png", string(newImageTestPng(400, 200))}},
+	})
+	_, err = ir.UploadFile("avatar", rule)
+	assert.True(t, xerrors.Is(err, ErrUploadTooLarge), "%v", err)
+	assert.Equal(t, 1, len(storage.files))
+}
@@ -1,20 +1,23 @@
 package iron
 
 import (
+	"context"
 	"log"
 	"net/http"
-	"os"
 	"path"
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type ServeMux struct {
 	server      *Server
 	mu          sync.RWMutex
-	m           map[string]muxEntry
-	hosts       bool // whether any patterns contain hostnames
+	m           map[string]*muxEntry
+	trees       map[string]*routeNode // radix tree per host, "" for any host
+	hosts       bool                  // whether any patterns contain hostnames
+	statics     []*staticMount        // sorted by prefix length desc
 	serveHTTPer ServeHTTPer
 	reqSeter    SetReuqestFunc
 	reqGeter    GetReuqestFunc
@@ -22,11 +25,29 @@ type ServeMux struct {
 
 // NewServeMux allocates and returns a new ServeMux.
 func (p *Server) NewServeMux() *ServeMux {
-	ret := &ServeMux{server: p, m: make(map[string]muxEntry)}
+	ret := &ServeMux{
+		server: p,
+		m:      make(map[string]*muxEntry),
+		trees:  map[string]*routeNode{"": &routeNode{}},
+	}
 	return ret
 }
 
 func (mux *ServeMux) Handle(pattern string, handler Handler) {
+	mux.handle("", pattern, handler)
+}
+
+// HandleMethod registers the handler for the given pattern and HTTP
+// method. Requests matching the pattern with a method nobody registered
+// are answered with 405, OPTIONS requests with the Allow list.
+func (mux *ServeMux) HandleMethod(method, pattern string, handler Handler) {
+	if method == "" {
+		panic("http: invalid method for " + pattern)
+	}
+	mux.handle(strings.ToUpper(method), pattern, handler)
+}
+
+func (mux *ServeMux) handle(method, pattern string, handler Handler) {
 	mux.mu.Lock()
 	defer mux.mu.Unlock()
 
@@ -36,21 +57,35 @@ func (mux *ServeMux) Handle(pattern string, handler Handler) {
 	if handler == nil {
 		panic("http: nil handler")
 	}
-	if mux.m[pattern].explicit {
-		panic("http: multiple registrations for " + pattern)
-	}
 
-	mux.m[pattern] = muxEntry{explicit: true, h: handler, pattern: pattern}
+	var entry = mux.m[pattern]
+	if entry == nil || !entry.explicit {
+		entry = &muxEntry{explicit: true, pattern: pattern}
+		mux.m[pattern] = entry
+		mux.addRoute(pattern, entry)
+	}
 
-	if pattern[0] != '/' {
-		mux.hosts = true
+	if method == "" {
+		if entry.h != nil {
+			panic("http: multiple registrations for " + pattern)
+		}
+		entry.h = handler
+	} else {
+		if entry.methods[method] != nil {
+			panic("http: multiple registrations for " + method + " " + pattern)
+		}
+		if entry.methods == nil {
+			entry.methods = make(map[string]Handler)
+		}
+		entry.methods[method] = handler
 	}
 
 	// Helpful behavior:
 	// If pattern is /tree/, insert an implicit permanent redirect for /tree.
-	// It can be overridden by an explicit registration.
+	// It can be overridden by an explicit registration. "/" has none, ""
+	// is no pattern.
 	n := len(pattern)
-	if n > 0 && pattern[n-1] == '/' && !mux.m[pattern[0:n-1]].explicit {
+	if n > 1 && pattern[n-1] == '/' && (mux.m[pattern[0:n-1]] == nil || !mux.m[pattern[0:n-1]].explicit) {
 		// If pattern contains a host name, strip it and use remaining
 		// path for redirect.
 		path := pattern
@@ -59,33 +94,35 @@ func (mux *ServeMux) Handle(pattern string, handler Handler) {
 			// strings.Index can't be -1.
 			path = pattern[strings.Index(pattern, "/"):]
 		}
-		mux.m[pattern[0:n-1]] = muxEntry{h: RedirectHandler(path, http.StatusMovedPermanently), pattern: pattern}
+		var redirect = RedirectHandler(path, http.StatusMovedPermanently)
+		if strings.ContainsAny(path, ":*") {
+			// The pattern is no URL, redirect to what was requested.
+			redirect = &trailingSlashRedirectHandler{http.StatusMovedPermanently}
+		}
+		mux.m[pattern[0:n-1]] = &muxEntry{h: redirect, pattern: pattern}
+		mux.addRoute(pattern[0:n-1], mux.m[pattern[0:n-1]])
 	}
 }
 
-// Does path match pattern?
-func pathMatch(pattern, path string) bool {
-	if len(pattern) == 0 {
-		// should not happen
-		return false
-	}
-
-	n := len(pattern)
-
-	if pattern == "*" {
-		return true
-	}
-
-	if pattern[n-1] == '*' {
-		if strings.HasPrefix(path, pattern[:n-1]) {
-			return true
+// addRoute inserts entry into the radix tree of the pattern's host.
+func (mux *ServeMux) addRoute(pattern string, entry *muxEntry) {
+	var host string
+	if pattern != "*" && pattern[0] != '/' {
+		mux.hosts = true
+		var i = strings.Index(pattern, "/")
+		if i < 0 {
+			// A bare host never matches as paths always start with '/'.
+			return
 		}
+		host, pattern = pattern[:i], pattern[i:]
 	}
 
-	if pattern[n-1] != '/' {
-		return pattern == path
+	var root, ok = mux.trees[host]
+	if !ok {
+		root = &routeNode{}
+		mux.trees[host] = root
 	}
-	return len(path) >= n && path[0:n] == pattern
+	root.addRoute(pattern, entry)
 }
 
 // Return the canonical path for p, eliminating . and .. elements.
@@ -105,51 +142,56 @@ func cleanPath(p string) string {
 	return np
 }
 
-// Find a handler on a handler map given a path string
-// Most-specific (longest) pattern wins
-func (mux *ServeMux) match(path string) (h Handler, pattern string) {
-	var n = 0
-	for k, v := range mux.m {
-		if !pathMatch(k, path) {
-			continue
-		}
-		if h == nil || len(k) > n {
-			n = len(k)
-			h = v.h
-			pattern = v.pattern
-		}
+// Find a handler in the radix tree of host given a path string.
+// Exact and param patterns win over prefix ones, and the most-specific
+// (longest) prefix pattern wins among those.
+func (mux *ServeMux) match(method, host, path string) (h Handler, pattern string, params Params, isPrefix bool) {
+	var root, ok = mux.trees[host]
+	if !ok {
+		return
+	}
+	var entry *muxEntry
+	if entry, params, isPrefix = root.getValue(path, nil); entry != nil {
+		h, pattern = entry.handler(method), entry.pattern
 	}
 	return
 }
 
-func (mux *ServeMux) handler(host, path string) (h Handler, pattern string) {
+func (mux *ServeMux) handler(method, host, path string) (h Handler, pattern string, params Params, isPrefix bool) {
 	mux.mu.RLock()
 	defer mux.mu.RUnlock()
 
 	// Host-specific pattern takes precedence over generic ones
 	if mux.hosts {
-		h, pattern = mux.match(host + path)
+		h, pattern, params, isPrefix = mux.match(method, host, path)
 	}
 	if h == nil {
-		h, pattern = mux.match(path)
+		h, pattern, params, isPrefix = mux.match(method, "", path)
 	}
 	if h == nil {
-		h, pattern = mux.server.NotFoundHandler, ""
+		h, pattern, params, isPrefix = mux.server.NotFoundHandler, "", nil, true
 	}
 	return
 }
 
 func (mux *ServeMux) Handler(r *http.Request) (h Handler, pattern string) {
+	h, pattern, _, _ = mux.lookup(r)
+	return
+}
+
+// lookup is Handler plus the captured path params, isPrefix is false
+// only when r matched an exact, param or catch-all pattern.
+func (mux *ServeMux) lookup(r *http.Request) (h Handler, pattern string, params Params, isPrefix bool) {
 	if r.Method != "CONNECT" {
 		if p := cleanPath(r.URL.Path); p != r.URL.Path {
-			_, pattern = mux.handler(r.Host, p)
+			_, pattern, _, _ = mux.handler(r.Method, r.Host, p)
 			url := *r.URL
 			url.Path = p
-			return RedirectHandler(url.String(), http.StatusMovedPermanently), pattern
+			return RedirectHandler(url.String(), http.StatusMovedPermanently), pattern, nil, true
 		}
 	}
 
-	return mux.handler(r.Host, r.URL.Path)
+	return mux.handler(r.Method, r.Host, r.URL.Path)
 }
 
 func (mux *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -161,12 +203,17 @@ func (mux *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var ok bool
+	atomic.AddInt64(&mux.server.inflightCount, 1)
+	defer atomic.AddInt64(&mux.server.inflightCount, -1)
+
 	var ir *Request = &Request{server: mux.server}
 	if mux.reqSeter != nil {
 		r = mux.reqSeter(r, ir)
 	}
 	ir.Init(w, r)
+	mux.server.wrapCompress(ir)
+
+	defer mux.finishRequest(ir)
 
 	for _, h := range mux.server.Hook.BeforeServeRequest {
 		if mux.IsRequestURIMatchHookBase(ir, &h.HookBase) {
@@ -182,51 +229,23 @@ func (mux *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	defer func() {
-		err := recover()
-		if nil == err {
-			return
-		}
-		log.Println(string(debug.Stack()))
-		log.Println(err)
-		for _, h := range mux.server.Hook.ErrorRecovers {
-			h(ir, err)
-		}
-
-		for _, h := range mux.server.Hook.AfterHttpHandles {
-			if mux.IsRequestURIMatchHookBase(ir, &h.HookBase) {
-				if !h.Func(ir) {
-					break
-				}
-			}
-		}
-
-		if mux.server.isClosedAfterHandle {
-			log.Println("Server closed.")
-			os.Exit(0)
-		}
-	}()
-
 	if mux.serveHTTPer != nil {
-		mux.serveHTTPer.ServeHTTP(w, r)
+		mux.serveHTTPer.ServeHTTP(ir.W, r)
 
 	} else {
-		_, ok = mux.server.httpMux.m[ir.R.URL.Path]
-		if ok {
-			h, _ := mux.Handler(r)
+		// exact patterns win over static mounts, which win over param,
+		// catch-all and prefix ones
+		h, _, params, isPrefix := mux.lookup(ir.R)
+		if !isPrefix && len(params) == 0 {
 			h.TinyironServeHTTP(ir)
 			return
 		}
 
-		if strings.HasPrefix(ir.R.URL.Path, "/static") {
-			file := path.Join(mux.server.Options.SiteStaticBasePath, ir.R.URL.Path[8:])
-			if FileExists(file) {
-				http.ServeFile(ir.W, ir.R, file)
-				return
-			}
+		if mux.serveStatic(ir) {
+			return
 		}
 
-		h, _ := mux.Handler(r)
+		ir.Params = params
 		h.TinyironServeHTTP(ir)
 		return
 		// w.WriteHeader(http.StatusNotFound)
@@ -235,8 +254,76 @@ func (mux *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// finishRequest ends the request lifecycle: on panic it logs the stack,
+// runs the error recover hooks then HandlePanic, it saves the session
+// and ends the compressed body, then the after handle hooks always run,
+// with ir.Status,
+// ir.BytesWritten and ir.Elapsed available to them.
+func (mux *ServeMux) finishRequest(ir *Request) {
+	err := recover()
+	if nil != err {
+		var stack []byte
+		if gp, ok := err.(*goroutinePanic); ok {
+			err, stack = gp.err, gp.stack
+		} else {
+			stack = debug.Stack()
+		}
+		log.Println("request id:", ir.Id, ", panic:", err)
+		log.Println(string(stack))
+
+		// Every hook runs whatever it returns, the default 500 response
+		// is skipped once one of them has written something.
+		for _, h := range mux.server.Hook.ErrorRecovers {
+			h(ir, err)
+		}
+		mux.server.HandlePanic(ir, err, stack)
+	}
+
+	ir.saveSession()
+	closeCompress(ir)
+
+	for _, h := range mux.server.Hook.AfterHttpHandles {
+		if mux.IsRequestURIMatchHookBase(ir, &h.HookBase) {
+			if !h.Func(ir) {
+				break
+			}
+		}
+	}
+
+	if nil != err && mux.server.isClosedAfterHandle {
+		go mux.server.Shutdown(context.Background())
+	}
+}
+
 // HandleFunc registers the handler function for the given pattern.
 func (mux *ServeMux) HandleFunc(pattern string, handler func(*Request)) {
 	h := &HandleFunc{mux.server, handler}
 	mux.Handle(pattern, h)
 }
+
+// HandleMethodFunc registers the handler function for the given pattern
+// and HTTP method.
+func (mux *ServeMux) HandleMethodFunc(method, pattern string, handler func(*Request)) {
+	h := &HandleFunc{mux.server, handler}
+	mux.HandleMethod(method, pattern, h)
+}
+
+func (mux *ServeMux) GET(pattern string, handler func(*Request)) {
+	mux.HandleMethodFunc(http.MethodGet, pattern, handler)
+}
+
+func (mux *ServeMux) POST(pattern string, handler func(*Request)) {
+	mux.HandleMethodFunc(http.MethodPost, pattern, handler)
+}
+
+func (mux *ServeMux) PUT(pattern string, handler func(*Request)) {
+	mux.HandleMethodFunc(http.MethodPut, pattern, handler)
+}
+
+func (mux *ServeMux) DELETE(pattern string, handler func(*Request)) {
+	mux.HandleMethodFunc(http.MethodDelete, pattern, handler)
+}
+
+func (mux *ServeMux) PATCH(pattern string, handler func(*Request)) {
+	mux.HandleMethodFunc(http.MethodPatch, pattern, handler)
+}
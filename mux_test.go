@@ -0,0 +1,189 @@
+package iron
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prepareMuxServer() *Server {
+	var server Server
+	AssertErrIsNil(server.Init(Options{}))
+	return &server
+}
+
+func serveMuxForTest(server *Server, host, path string) *httptest.ResponseRecorder {
+	var w = httptest.NewRecorder()
+	var r = httptest.NewRequest("GET", path, nil)
+	if host != "" {
+		r.Host = host
+	}
+	server.httpMux.ServeHTTP(w, r)
+	return w
+}
+
+func TestServeMuxParams(t *testing.T) {
+	var server = prepareMuxServer()
+	server.Router("/user/:id/posts/:postId", func(ir *Request) {
+		ir.W.Write([]byte("posts:" + ir.Param("id") + "," + ir.Param("postId")))
+	})
+	server.Router("/user/:id", func(ir *Request) {
+		ir.W.Write([]byte("user:" + ir.Param("id")))
+	})
+	server.Router("/user/new", func(ir *Request) {
+		ir.W.Write([]byte("new"))
+	})
+	server.Router("/files/*filepath", func(ir *Request) {
+		ir.W.Write([]byte("files:" + ir.Param("filepath")))
+	})
+
+	assert.Equal(t, "posts:12,34", serveMuxForTest(server, "", "/user/12/posts/34").Body.String())
+	assert.Equal(t, "user:12", serveMuxForTest(server, "", "/user/12").Body.String())
+	assert.Equal(t, "new", serveMuxForTest(server, "", "/user/new").Body.String())
+	assert.Equal(t, "files:css/a.css", serveMuxForTest(server, "", "/files/css/a.css").Body.String())
+	assert.Equal(t, `{"Code":-1,"Error":"command not found","Data":null}`,
+		serveMuxForTest(server, "", "/user/12/posts").Body.String())
+}
+
+func TestServeMuxLegacyPatterns(t *testing.T) {
+	var server = prepareMuxServer()
+	server.Router("/Argon/*", func(ir *Request) {
+		ir.W.Write([]byte("argon"))
+	})
+	server.Router("/Argon/Exact", func(ir *Request) {
+		ir.W.Write([]byte("exact"))
+	})
+	server.Router("/tree/", func(ir *Request) {
+		ir.W.Write([]byte("tree"))
+	})
+	server.Router("/tree/sub/", func(ir *Request) {
+		ir.W.Write([]byte("sub"))
+	})
+	server.Router("iron.example/", func(ir *Request) {
+		ir.W.Write([]byte("host"))
+	})
+
+	assert.Equal(t, "argon", serveMuxForTest(server, "", "/Argon/Test").Body.String())
+	assert.Equal(t, "exact", serveMuxForTest(server, "", "/Argon/Exact").Body.String())
+	assert.Equal(t, "argon", serveMuxForTest(server, "", "/Argon/Exact/More").Body.String())
+	assert.Equal(t, "tree", serveMuxForTest(server, "", "/tree/a/b").Body.String())
+	assert.Equal(t, "sub", serveMuxForTest(server, "", "/tree/sub/c").Body.String())
+	assert.Equal(t, "host", serveMuxForTest(server, "iron.example", "/tree/a").Body.String())
+
+	var w = serveMuxForTest(server, "", "/tree")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/tree/", w.Header().Get("Location"))
+}
+
+func TestServeMuxMethods(t *testing.T) {
+	var server = prepareMuxServer()
+	server.GET("/item/:id", func(ir *Request) {
+		ir.W.Write([]byte("get:" + ir.Param("id")))
+	})
+	server.POST("/item/:id", func(ir *Request) {
+		ir.W.Write([]byte("post:" + ir.Param("id")))
+	})
+	server.Router("/any", func(ir *Request) {
+		ir.W.Write([]byte("any:" + ir.R.Method))
+	})
+
+	var serve = func(method, path string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	assert.Equal(t, "get:1", serve("GET", "/item/1").Body.String())
+	assert.Equal(t, "post:1", serve("POST", "/item/1").Body.String())
+	assert.Equal(t, "any:DELETE", serve("DELETE", "/any").Body.String())
+
+	var w = serve("DELETE", "/item/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", w.Header().Get("Allow"))
+	assert.Equal(t, `{"Code":-1,"Error":"method not allowed","Data":null}`, w.Body.String())
+
+	w = serve("OPTIONS", "/item/1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", w.Header().Get("Allow"))
+}
+
+func TestRouterGroup(t *testing.T) {
+	var (
+		server = prepareMuxServer()
+		trace  []string
+	)
+
+	var admin = server.Group("/admin", func(ir *Request) bool {
+		trace = append(trace, "admin")
+		return ir.R.Header.Get("X-Token") == "secret"
+	})
+	admin.HookAfterHttpHandle(func(ir *Request) bool {
+		trace = append(trace, "admin-after")
+		return true
+	})
+
+	var users = admin.Group("/users", func(ir *Request) bool {
+		trace = append(trace, "users")
+		return true
+	})
+	users.GET("/:id", func(ir *Request) {
+		trace = append(trace, "handle")
+		ir.W.Write([]byte("user:" + ir.Param("id")))
+	})
+	server.GET("/public", func(ir *Request) {
+		trace = append(trace, "public")
+	})
+
+	var r = httptest.NewRequest("GET", "/admin/users/7", nil)
+	r.Header.Set("X-Token", "secret")
+	var w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, r)
+	assert.Equal(t, "user:7", w.Body.String())
+	assert.Equal(t, []string{"admin", "users", "handle", "admin-after"}, trace)
+
+	trace = nil
+	serveMuxForTest(server, "", "/admin/users/7")
+	assert.Equal(t, []string{"admin"}, trace)
+
+	trace = nil
+	serveMuxForTest(server, "", "/public")
+	assert.Equal(t, []string{"public"}, trace)
+}
+
+func TestServeMuxRoot(t *testing.T) {
+	var server = prepareMuxServer()
+	server.Router("/", func(ir *Request) {
+		ir.W.Write([]byte("root:" + ir.R.URL.Path))
+	})
+
+	assert.Equal(t, "root:/", serveMuxForTest(server, "", "/").Body.String())
+	assert.Equal(t, "root:/a/b", serveMuxForTest(server, "", "/a/b").Body.String())
+}
+
+func TestServeMuxParamRedirect(t *testing.T) {
+	var server = prepareMuxServer()
+	server.Router("/user/:id/", func(ir *Request) {
+		ir.W.Write([]byte("user:" + ir.Param("id")))
+	})
+
+	assert.Equal(t, "user:12", serveMuxForTest(server, "", "/user/12/").Body.String())
+	var w = serveMuxForTest(server, "", "/user/12?tab=posts")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/user/12/?tab=posts", w.Header().Get("Location"))
+}
+
+func TestRouteNodeCatchAllFallback(t *testing.T) {
+	var (
+		root   = &routeNode{}
+		legacy = &muxEntry{pattern: "/files/"}
+	)
+	root.addRoute("/files/", legacy)
+	// a catch-all node without entry must not hide the prefix pattern
+	root.children[0].catchAllChild = &routeNode{paramName: "filepath"}
+
+	var entry, _, isPrefix = root.getValue("/files/a.css", nil)
+	assert.Equal(t, legacy, entry)
+	assert.True(t, isPrefix)
+}
@@ -0,0 +1,230 @@
+package iron
+
+import "strings"
+
+// Param is a single captured path parameter.
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params holds the path parameters captured by a pattern such as
+// /user/:id or /files/*filepath, in pattern order.
+type Params []Param
+
+// Get returns the value of the first param with the given key.
+func (p Params) Get(key string) (string, bool) {
+	for i := range p {
+		if p[i].Key == key {
+			return p[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// routeNode is a node of the radix tree used by ServeMux.
+//
+// Static text is compressed along edges, while :param and *catchAll
+// segments hang from dedicated children so a node can hold all three
+// kinds at once. Lookup prefers static over param over catchAll and
+// backtracks when a branch does not lead to a match.
+type routeNode struct {
+	path     string
+	indices  string
+	children []*routeNode
+
+	paramChild    *routeNode
+	catchAllChild *routeNode
+	paramName     string
+
+	// entry matches when the path ends exactly at this node.
+	entry *muxEntry
+	// prefixEntry matches any path going through this node, it is how
+	// the legacy /tree/ and /tree/* patterns are stored.
+	prefixEntry *muxEntry
+}
+
+// addRoute inserts pattern into the tree. Patterns ending with '/' or a
+// bare '*' are prefix patterns, ':name' captures one segment and
+// '*name' captures the rest of the path.
+func (n *routeNode) addRoute(pattern string, entry *muxEntry) {
+	var (
+		cur      = n
+		rest     = pattern
+		isPrefix = false
+	)
+
+	if strings.HasSuffix(rest, "*") {
+		rest = rest[:len(rest)-1]
+		isPrefix = true
+	} else if strings.HasSuffix(rest, "/") {
+		isPrefix = true
+	}
+
+	for {
+		var i = strings.IndexAny(rest, ":*")
+		if i < 0 {
+			cur = cur.insertStatic(rest)
+			break
+		}
+
+		cur = cur.insertStatic(rest[:i])
+		rest = rest[i:]
+
+		var end = strings.IndexByte(rest, '/')
+		if end < 0 {
+			end = len(rest)
+		}
+		var name = rest[1:end]
+		if name == "" {
+			panic("iron: wildcard must be named in path '" + pattern + "'")
+		}
+
+		if rest[0] == '*' {
+			if end != len(rest) {
+				panic("iron: catch-all routes are only allowed at the end of the path '" + pattern + "'")
+			}
+			if cur.catchAllChild == nil {
+				cur.catchAllChild = &routeNode{paramName: name}
+			} else if cur.catchAllChild.paramName != name {
+				panic("iron: '*" + name + "' in path '" + pattern +
+					"' conflicts with existing wildcard '*" + cur.catchAllChild.paramName + "'")
+			}
+			cur = cur.catchAllChild
+			rest = ""
+			break
+		}
+
+		if cur.paramChild == nil {
+			cur.paramChild = &routeNode{paramName: name}
+		} else if cur.paramChild.paramName != name {
+			panic("iron: ':" + name + "' in path '" + pattern +
+				"' conflicts with existing wildcard ':" + cur.paramChild.paramName + "'")
+		}
+		cur = cur.paramChild
+		rest = rest[end:]
+	}
+
+	if isPrefix {
+		// Longest pattern wins when both /tree/ and /tree/* are registered.
+		if cur.prefixEntry == nil || len(cur.prefixEntry.pattern) <= len(entry.pattern) {
+			cur.prefixEntry = entry
+		}
+	}
+	if !isPrefix || strings.HasSuffix(pattern, "/") {
+		cur.entry = entry
+	}
+}
+
+// insertStatic walks or splits the static edges below n for s and returns
+// the node where s ends.
+func (n *routeNode) insertStatic(s string) *routeNode {
+	var cur = n
+	for s != "" {
+		var child *routeNode
+		for i := 0; i < len(cur.indices); i++ {
+			if cur.indices[i] == s[0] {
+				child = cur.children[i]
+				break
+			}
+		}
+
+		if child == nil {
+			child = &routeNode{path: s}
+			cur.indices += string(s[0])
+			cur.children = append(cur.children, child)
+			return child
+		}
+
+		var common = 0
+		for common < len(s) && common < len(child.path) && s[common] == child.path[common] {
+			common++
+		}
+
+		if common < len(child.path) {
+			var split = &routeNode{
+				path:          child.path[common:],
+				indices:       child.indices,
+				children:      child.children,
+				paramChild:    child.paramChild,
+				catchAllChild: child.catchAllChild,
+				entry:         child.entry,
+				prefixEntry:   child.prefixEntry,
+			}
+			*child = routeNode{
+				path:     child.path[:common],
+				indices:  string(split.path[0]),
+				children: []*routeNode{split},
+			}
+		}
+
+		cur = child
+		s = s[common:]
+	}
+	return cur
+}
+
+// getValue looks up path below n, path being what is left once n.path
+// has been consumed. isPrefix reports whether the result came from a
+// prefix pattern rather than an exact, param or catch-all one.
+func (n *routeNode) getValue(path string, params Params) (entry *muxEntry, retParams Params, isPrefix bool) {
+	if path == "" && n.entry != nil {
+		return n.entry, params, false
+	}
+
+	var (
+		fallback       *muxEntry
+		fallbackParams Params
+	)
+
+	if path != "" {
+		for i := 0; i < len(n.indices); i++ {
+			if n.indices[i] != path[0] {
+				continue
+			}
+			var child = n.children[i]
+			if strings.HasPrefix(path, child.path) {
+				entry, retParams, isPrefix = child.getValue(path[len(child.path):], params)
+				if entry != nil && !isPrefix {
+					return
+				}
+				if entry != nil {
+					fallback, fallbackParams = entry, retParams
+				}
+			}
+			break
+		}
+	}
+
+	if n.paramChild != nil && path != "" {
+		var end = strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			entry, retParams, isPrefix = n.paramChild.getValue(path[end:],
+				append(params[:len(params):len(params)], Param{n.paramChild.paramName, path[:end]}))
+			if entry != nil && !isPrefix {
+				return
+			}
+			if entry != nil && fallback == nil {
+				fallback, fallbackParams = entry, retParams
+			}
+		}
+	}
+
+	if n.catchAllChild != nil && n.catchAllChild.entry != nil {
+		return n.catchAllChild.entry,
+			append(params[:len(params):len(params)], Param{n.catchAllChild.paramName, path}), false
+	}
+
+	if fallback != nil {
+		return fallback, fallbackParams, true
+	}
+
+	if n.prefixEntry != nil {
+		return n.prefixEntry, params, true
+	}
+
+	return nil, nil, false
+}
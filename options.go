@@ -4,31 +4,92 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
 )
 
+// Options configures a Server.
+//
+// AccessWhiteList used to hold regexps matched against the client IP and
+// was parsed into an Options.AccessWhiteList slice. Both AccessWhiteList
+// and AccessBlackList now hold CIDR ranges or IPs, e.g. "192\\.168\\..*"
+// becomes "192.168.0.0/16", and are compiled into Server.AccessControl,
+// which also sets lists per path prefix at runtime.
 type Options struct {
 	RunMode            string `json:"RunMode"`
 	ServeType          string `json:"ServeType"`
 	ServeStr           string `json:"ServeStr"`
 	ListenStr          string `json:"ListenStr"`
 	LogPath            string `json:"LogPath"`
-	AccessWhiteListStr string `json:"AccessWhiteList"`
+	AccessWhiteListStr string `json:"AccessWhiteList"` // comma separated CIDR ranges or IPs
+	AccessBlackListStr string `json:"AccessBlackList"` // comma separated CIDR ranges or IPs
+	TrustedProxiesStr  string `json:"TrustedProxies"`  // comma separated CIDR ranges or IPs
+	ClientIpHeader     string `json:"ClientIpHeader"`  // the one header trusted proxies set, X-Forwarded-For, Forwarded or X-Real-IP
 
 	SiteViewDir              string `json:"SiteViewDir"`
 	SiteStaticBasePath       string `json:"SiteStaticBasePath"`
 	SiteStaticUploadBasePath string `json:"SiteStaticUploadBasePath"`
 
-	BaseDir           string   `json:"-"`
-	AccessWhiteList   []string `json:"-"`
-	Log               *os.File `json:"-"`
-	IsTMPLAutoRefresh bool     `json:"-"`
+	BaseDir           string       `json:"-"`
+	TrustedProxies    []*net.IPNet `json:"-"`
+	Log               *os.File     `json:"-"`
+	IsTMPLAutoRefresh bool         `json:"-"`
+
+	IsApiPanicStack bool `json:"ApiPanicStack"` // json 500s carry the panic value and stack in dev RunMode
+	IsDebugPage     bool `json:"DebugPage"`     // html 500s are the RenderDebugPage one in dev RunMode
 
 	HttpsListenStr string `json:"HttpsListenStr"`
 	HttpsCertPath  string `json:"HttpsCertPath"`
 	HttpsKeyPath   string `json:"HttpsKeyPath"`
+
+	ReadTimeoutStr       string `json:"ReadTimeout"` // e.g. "90s"
+	ReadHeaderTimeoutStr string `json:"ReadHeaderTimeout"`
+	WriteTimeoutStr      string `json:"WriteTimeout"`
+	IdleTimeoutStr       string `json:"IdleTimeout"`
+	MaxHeaderBytes       int    `json:"MaxHeaderBytes"`
+
+	ReadTimeout       time.Duration `json:"-"`
+	ReadHeaderTimeout time.Duration `json:"-"`
+	WriteTimeout      time.Duration `json:"-"`
+	IdleTimeout       time.Duration `json:"-"`
+
+	AccessLogPath           string `json:"AccessLogPath"`
+	AccessLogFormat         string `json:"AccessLogFormat"`         // common, combined, combined_id or json
+	AccessLogRotateSize     int64  `json:"AccessLogRotateSize"`     // in MB, 0 disables size rotation
+	AccessLogRotateInterval string `json:"AccessLogRotateInterval"` // e.g. "24h", empty disables time rotation
+	AccessLogCompress       bool   `json:"AccessLogCompress"`
+	AccessLogBufferSize     int    `json:"AccessLogBufferSize"`
+
+	AccessLogRotateDuration time.Duration `json:"-"`
+
+	IsCompress           bool   `json:"Compress"`
+	CompressMinSize      *int   `json:"CompressMinSize"`   // in bytes, smaller bodies are sent as is, unset means COMPRESS_MIN_SIZE_DEFAULT, 0 compresses every body
+	CompressTypesStr     string `json:"CompressTypes"`     // comma separated Content-Type prefixes
+	CompressEncodingsStr string `json:"CompressEncodings"` // comma separated by preference, of br, gzip and deflate
+
+	CompressTypes     []string `json:"-"`
+	CompressEncodings []string `json:"-"`
+
+	UploadMaxMemory   int64 `json:"UploadMaxMemory"`   // in MB, of a multipart body kept in memory, the rest goes to temp files
+	UploadMaxBodySize int64 `json:"UploadMaxBodySize"` // in MB, of a multipart body, 0 means no limit
+	BindMaxBodySize   int64 `json:"BindMaxBodySize"`   // in MB, of a json body read by Request.Bind, 0 means 1
+
+	ImageCacheDir string `json:"ImageCacheDir"` // of the variants of Server.Images, SiteStaticUploadBasePath/.cache by default
+
+	SessionCookieName     string `json:"SessionCookieName"`
+	SessionCookieDomain   string `json:"SessionCookieDomain"`
+	IsSessionCookieSecure bool   `json:"SessionCookieSecure"`
+	SessionSameSiteStr    string `json:"SessionSameSite"` // lax, strict or none
+	SessionMaxAgeStr      string `json:"SessionMaxAge"`   // e.g. "24h"
+
+	SessionSameSite http.SameSite `json:"-"`
+	SessionMaxAge   time.Duration `json:"-"`
 }
 
 func (p *Server) loadOptions(options Options) error {
@@ -84,14 +145,121 @@ func (p *Server) sanitizeOptions(options *Options) error {
 		log.SetOutput(options.Log)
 	}
 
-	options.AccessWhiteList = nil
-	if options.AccessWhiteListStr != "" {
-		options.AccessWhiteList = strings.Split(options.AccessWhiteListStr, ",")
-		for i := range options.AccessWhiteList {
-			options.AccessWhiteList[i] = strings.TrimSpace(options.AccessWhiteList[i])
+	for _, item := range []struct {
+		name       string
+		str        string
+		defaultRet time.Duration
+		ret        *time.Duration
+	}{
+		{"ReadTimeout", options.ReadTimeoutStr, 90 * time.Second, &options.ReadTimeout},
+		{"ReadHeaderTimeout", options.ReadHeaderTimeoutStr, 0, &options.ReadHeaderTimeout},
+		{"WriteTimeout", options.WriteTimeoutStr, 90 * time.Second, &options.WriteTimeout},
+		{"IdleTimeout", options.IdleTimeoutStr, 0, &options.IdleTimeout},
+	} {
+		*item.ret = item.defaultRet
+		if item.str != "" {
+			if *item.ret, err = time.ParseDuration(item.str); err != nil {
+				return xerrors.Errorf("invalid %s: %w", item.name, err)
+			}
+		}
+	}
+
+	if options.MaxHeaderBytes <= 0 {
+		options.MaxHeaderBytes = 1 << 20
+	}
+
+	switch options.AccessLogFormat {
+	case ACCESS_LOG_FORMAT_COMMON, ACCESS_LOG_FORMAT_COMBINED, ACCESS_LOG_FORMAT_COMBINED_ID, ACCESS_LOG_FORMAT_JSON:
+		break
+	default:
+		options.AccessLogFormat = ACCESS_LOG_FORMAT_COMBINED
+	}
+
+	options.AccessLogRotateDuration = 0
+	if options.AccessLogRotateInterval != "" {
+		options.AccessLogRotateDuration, err = time.ParseDuration(options.AccessLogRotateInterval)
+		if err != nil {
+			return xerrors.Errorf("invalid AccessLogRotateInterval: %w", err)
+		}
+	}
+
+	if options.AccessLogBufferSize <= 0 {
+		options.AccessLogBufferSize = 4096
+	}
+
+	if options.CompressMinSize == nil {
+		var minSize = COMPRESS_MIN_SIZE_DEFAULT
+		options.CompressMinSize = &minSize
+	} else if *options.CompressMinSize < 0 {
+		return xerrors.Errorf("invalid CompressMinSize: %d", *options.CompressMinSize)
+	}
+	if options.CompressTypesStr == "" {
+		options.CompressTypesStr = COMPRESS_TYPES_DEFAULT
+	}
+	if options.CompressEncodingsStr == "" {
+		options.CompressEncodingsStr = COMPRESS_ENCODINGS_DEFAULT
+	}
+	options.CompressTypes = splitTrim(options.CompressTypesStr)
+	options.CompressEncodings = splitTrim(options.CompressEncodingsStr)
+	for _, encoding := range options.CompressEncodings {
+		if _, ok := compressors[encoding]; !ok {
+			return xerrors.Errorf("invalid CompressEncodings: %s not supported", encoding)
+		}
+	}
+
+	if options.UploadMaxMemory <= 0 {
+		options.UploadMaxMemory = 32
+	}
+	if options.BindMaxBodySize <= 0 {
+		options.BindMaxBodySize = 1
+	}
+	if options.ImageCacheDir == "" {
+		// hidden, so neither served nor reachable as an upload name
+		options.ImageCacheDir = filepath.Join(options.SiteStaticUploadBasePath, ".cache")
+	}
+
+	if options.SessionCookieName == "" {
+		options.SessionCookieName = SESSION_COOKIE_NAME_DEFAULT
+	}
+	switch strings.ToLower(options.SessionSameSiteStr) {
+	case "", "lax":
+		options.SessionSameSite = http.SameSiteLaxMode
+	case "strict":
+		options.SessionSameSite = http.SameSiteStrictMode
+	case "none":
+		options.SessionSameSite = http.SameSiteNoneMode
+	default:
+		return xerrors.Errorf("invalid SessionSameSite: %s", options.SessionSameSiteStr)
+	}
+	options.SessionMaxAge = SESSION_MAX_AGE_DEFAULT
+	if options.SessionMaxAgeStr != "" {
+		if options.SessionMaxAge, err = time.ParseDuration(options.SessionMaxAgeStr); err != nil {
+			return xerrors.Errorf("invalid SessionMaxAge: %w", err)
+		}
+		if options.SessionMaxAge <= 0 {
+			return xerrors.Errorf("invalid SessionMaxAge: %s", options.SessionMaxAgeStr)
 		}
 	}
 
+	options.TrustedProxies, err = ParseIpNets(options.TrustedProxiesStr)
+	if err != nil {
+		return xerrors.Errorf("invalid TrustedProxies: %w", err)
+	}
+	switch strings.ToLower(options.ClientIpHeader) {
+	case "", "x-forwarded-for":
+		options.ClientIpHeader = CLIENT_IP_HEADER_X_FORWARDED_FOR
+	case "forwarded":
+		options.ClientIpHeader = CLIENT_IP_HEADER_FORWARDED
+	case "x-real-ip":
+		options.ClientIpHeader = CLIENT_IP_HEADER_X_REAL_IP
+	default:
+		return xerrors.Errorf("invalid ClientIpHeader: %s", options.ClientIpHeader)
+	}
+
+	if _, err = NewAccessList(options.AccessWhiteListStr, options.AccessBlackListStr); err != nil {
+		return xerrors.Errorf("invalid AccessWhiteList or AccessBlackList: %w", err)
+	}
+
 	return nil
 }
 
@@ -113,3 +281,14 @@ func LoadOptionsFile(optionsFilePath string, options interface{}) error {
 
 	return nil
 }
+
+// splitTrim splits a comma separated list, dropping blank items.
+func splitTrim(str string) []string {
+	var ret []string
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
@@ -1,6 +1,9 @@
 package iron
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestSanitizeOptions(t *testing.T) {
 	var (
@@ -8,11 +11,10 @@ func TestSanitizeOptions(t *testing.T) {
 	)
 
 	var options = Options{
-		RunMode:         "dev",
-		ServeType:       "server",
-		ListenStr:       "127.0.0.1:7812",
-		LogPath:         "./test.log",
-		AccessWhiteList: []string{},
+		RunMode:   "dev",
+		ServeType: "server",
+		ListenStr: "127.0.0.1:7812",
+		LogPath:   "./test.log",
 
 		SiteViewDir:              "./",
 		SiteStaticBasePath:       "./",
@@ -22,4 +24,25 @@ func TestSanitizeOptions(t *testing.T) {
 	var server Server
 	err = server.Init(options)
 	AssertErrIsNilForTest(t, err)
+	if server.Options.ReadTimeout != 90*time.Second || server.Options.IdleTimeout != 0 {
+		t.Error("unexpected default timeouts")
+	}
+
+	options.IdleTimeoutStr = "2m"
+	err = server.Init(options)
+	AssertErrIsNilForTest(t, err)
+	if server.httpServer.IdleTimeout != 2*time.Minute {
+		t.Error("IdleTimeout not applied")
+	}
+
+	options.WriteTimeoutStr = "soon"
+	if err = server.Init(options); err == nil {
+		t.Error("invalid WriteTimeout accepted")
+	}
+	options.WriteTimeoutStr = ""
+
+	options.CompressEncodingsStr = "gzip, zstd"
+	if err = server.Init(options); err == nil {
+		t.Error("invalid CompressEncodings accepted")
+	}
 }
@@ -1,8 +1,10 @@
 package iron
 
 import (
+	"context"
 	"reflect"
 	"strings"
+	"time"
 
 	"golang.org/x/xerrors"
 )
@@ -12,10 +14,14 @@ type ProxyService struct {
 	Function            reflect.Value
 	Params              []reflect.Type
 	IsHasReqeustContext bool
+	IsHasContext        bool // first param is a context.Context
 	IsHasEasyKvReqArgs  bool
 	IsHasUrlKvReqArgs   bool
+	Timeout             time.Duration // 0 means no deadline
 }
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 type ProxyBeforeServiceHook func(path string,
 	reqCtx RequestContext, resp IResponse, reqArgs ...LowReqArgs) (ret IResponse, isContinue bool)
 type ProxyAfterServiceHook func(path string,
@@ -61,6 +67,7 @@ func (p *Proxy) RegisterService(path string, handler interface{}) {
 	// }
 
 	service.IsHasReqeustContext = funcType.NumIn() > 0 && strings.HasSuffix(funcType.In(0).String(), "Context")
+	service.IsHasContext = funcType.NumIn() > 0 && funcType.In(0) == contextType
 	// if !strings.HasSuffix(funcType.In(0).Elem().Name(), "Context") {
 	// panic("Proxy Router failed, handler params[0] should be RequestContext, service:" + service.FunctionName)
 	// }
@@ -110,6 +117,19 @@ func (p *Proxy) RegisterService(path string, handler interface{}) {
 	p.ServiceTable[path] = service
 }
 
+// SetServiceTimeout sets the deadline of the service registered at path.
+// The context given to the service is canceled once it passes, and
+// Dispatch stops waiting and returns a CODE_TIMEOUT Response, which
+// WebServe answers with a 503 as TimeoutHandler does.
+func (p *Proxy) SetServiceTimeout(path string, timeout time.Duration) {
+	var service, ok = p.ServiceTable[path]
+	if !ok {
+		panic("Proxy SetServiceTimeout failed, service not exists, path:" + path)
+	}
+	service.Timeout = timeout
+	p.ServiceTable[path] = service
+}
+
 func (p *Proxy) HookBeforeService(path string, hook ProxyBeforeServiceHook) {
 	var arr, ok = p.HookBeforeServiceTable[path]
 	if !ok {
@@ -149,12 +169,24 @@ func (p *Proxy) Dispatch(path string,
 		service              = p.ServiceTable[path]
 	)
 
-	var ok bool
+	var ctx, ok = contextOf(reqCtx)
+	if !ok {
+		ctx = context.Background()
+	}
+	if service.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, service.Timeout)
+		defer cancel()
+	}
+
 	var paramReflectValueArrIndex = 0
 	var reqArgsIndex = 0
 	if service.IsHasReqeustContext {
 		paramReflectValueArr = make([]reflect.Value, len(reqArgs)+1)
 		paramReflectValueArr[paramReflectValueArrIndex] = reflect.ValueOf(reqCtx)
+		if service.IsHasContext {
+			paramReflectValueArr[paramReflectValueArrIndex] = reflect.ValueOf(&ctx).Elem()
+		}
 		paramReflectValueArrIndex++
 	} else {
 		paramReflectValueArr = make([]reflect.Value, len(reqArgs))
@@ -200,13 +232,20 @@ func (p *Proxy) Dispatch(path string,
 	}
 
 	var (
-		out    = service.Function.Call(paramReflectValueArr[:])
-		outLen = len(out)
-		match  bool
-		ret    []interface{}
-		index  int
+		out, isTimeout = p.callService(ctx, service, paramReflectValueArr[:])
+		outLen         = len(out)
+		match          bool
+		ret            []interface{}
+		index          int
 	)
 
+	if isTimeout {
+		resp = Response{
+			RespCommon{CODE_TIMEOUT, ErrTimeout.Error()}, nil,
+		}
+		goto PARSE_RESP_DONE
+	}
+
 	if outLen == 0 {
 		resp = Response{
 			RespCommon{CODE_OK, ""}, nil,
@@ -279,6 +318,40 @@ PARSE_RESP_DONE:
 	return resp
 }
 
+// callService calls the service function, a service with a Timeout is
+// given up once its deadline is exceeded, even if it ignores ctx. Other
+// cancelations of ctx, such as the client going away, are left to the
+// service. A panic of the service is raised again in the caller goroutine.
+func (p *Proxy) callService(ctx context.Context, service ProxyService, params []reflect.Value) (out []reflect.Value, isTimeout bool) {
+	if service.Timeout <= 0 {
+		return service.Function.Call(params), false
+	}
+
+	var (
+		outChan   = make(chan []reflect.Value, 1)
+		panicChan = make(chan interface{}, 1)
+		doneChan  = ctx.Done()
+	)
+	go func() {
+		defer recoverTo(panicChan)
+		outChan <- service.Function.Call(params)
+	}()
+
+	for {
+		select {
+		case out = <-outChan:
+			return out, false
+		case err := <-panicChan:
+			panic(err)
+		case <-doneChan:
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, true
+			}
+			doneChan = nil
+		}
+	}
+}
+
 func (p *Proxy) IsServiceExists(path string) bool {
 	var _, ok = p.ServiceTable[path]
 	return ok
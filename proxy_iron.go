@@ -33,6 +33,12 @@ func (p *Proxy) DispatchWithIronRequest(path string, reqCtx RequestContext, req
 	var service = p.ServiceTable[path]
 	var reqArgElems []interface{}
 
+	// Services taking a context.Context get the one of the http request,
+	// so client disconnects and deadlines reach them.
+	if _, ok := contextOf(reqCtx); service.IsHasContext && !ok {
+		reqCtx = req.Context()
+	}
+
 	var parseEasyKvReqArgs = func() error {
 		var reqArgs = MakeEasyKvReqArgs()
 
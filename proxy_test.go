@@ -2,6 +2,7 @@ package iron
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -28,6 +29,7 @@ func prepareServer(port int) {
 	proxy.RegisterService("/TestLowReqArgs", ProxyServiceTestLowReqArgs)
 	proxy.RegisterService("/TestUrlKvReqArgs", ProxyServiceTestUrlKvReqArgs)
 	proxy.RegisterService("/TestEasyKvReqArgs", ProxyServiceTestEasyKvReqArgs)
+	proxy.RegisterService("/TestContext", ProxyServiceTestContext)
 
 	var webOptions Options
 	webOptions.ListenStr = testProxyListenStr
@@ -200,3 +202,34 @@ func TestProxyEasyKvReqArgs(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, `{"Code":0,"Error":"","Data":"1010test"}`, string(respBytes))
 }
+
+type proxyTestContextKey struct{}
+
+func ProxyServiceTestContext(ctx context.Context, req ProxyServiceTestReq) (string, error) {
+	AssertTrue(ctx.Err() == nil)
+	var value, _ = ctx.Value(proxyTestContextKey{}).(string)
+	return fmt.Sprintf("%v-%v%v", req.C, RequestFromContext(ctx) != nil, value), nil
+}
+
+func TestProxyContext(t *testing.T) {
+	var proxy Proxy
+	AssertErrIsNil(proxy.Init())
+	proxy.RegisterService("/TestContext", ProxyServiceTestContext)
+
+	var ctx = context.WithValue(context.Background(), proxyTestContextKey{}, "-value")
+	var resp = proxy.Dispatch("/TestContext", ctx, ProxyServiceTestReq{C: "dispatch"})
+	assert.Equal(t, "dispatch-false-value", resp.(Response).RespData)
+
+	var serverPort = 17205
+	prepareServer(serverPort)
+	var (
+		respBytes []byte
+		err       error
+	)
+	httpResp, err := http.Post(testProxyUrlP(serverPort, "/TestContext"),
+		"application/json", bytes.NewBufferString(`{"C":"web"}`))
+	assert.NoError(t, err)
+	respBytes, err = ioutil.ReadAll(httpResp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Code":0,"Error":"","Data":"web-true"}`, string(respBytes))
+}
@@ -1,6 +1,9 @@
 package iron
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"net/http"
+)
 
 func (p *Proxy) InitStandAloneWebServer(prefix string, options Options) error {
 	var err error
@@ -27,8 +30,13 @@ func (p *Proxy) StandAloneWebServerServe() error {
 
 func (p *Proxy) WebServe(ir *Request) {
 	var path = ir.R.URL.Path[len(p.WebRouterPrefix):]
-	var reqCtx RequestContext
+	// Services and hooks get a *RequestContext holding the request context,
+	// see RequestIdFromContext.
+	var reqCtx RequestContext = ir.Context()
 	var resp = p.DispatchWithIronRequest(path, &reqCtx, ir)
 	res, _ := json.Marshal(resp)
+	if commonResp, ok := resp.(Response); ok && commonResp.Code == CODE_TIMEOUT {
+		ir.W.WriteHeader(http.StatusServiceUnavailable)
+	}
 	ir.W.Write(res)
 }
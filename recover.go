@@ -0,0 +1,89 @@
+package iron
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// goroutinePanic carries a panic recovered in a goroutine started for the
+// request back to the request goroutine, with the stack where it happened,
+// finishRequest logs and handles the original value and stack.
+type goroutinePanic struct {
+	err   interface{}
+	stack []byte
+}
+
+// recoverTo is deferred by goroutines started for a request, it sends a
+// panic to panicChan to be raised again in the request goroutine.
+func recoverTo(panicChan chan<- interface{}) {
+	if err := recover(); err != nil {
+		if _, ok := err.(*goroutinePanic); !ok {
+			err = &goroutinePanic{err, debug.Stack()}
+		}
+		panicChan <- err
+	}
+}
+
+// HandlePanic is the default recovery run after the error recover hooks
+// when a handler panicked and nothing has been written yet. It answers
+// 500 with the json envelope, or a html page for view requests. As RunMode
+// defaults to dev, the panic details are shown only when opted in too:
+// the html page is the RenderDebugPage one with Options.IsDebugPage, and
+// the json envelope carries the panic value and stack with
+// Options.IsApiPanicStack.
+func (p *Server) HandlePanic(ir *Request, err interface{}, stack []byte) {
+	if ir.IsHeaderWritten() {
+		return
+	}
+
+	var (
+		errmsg  = http.StatusText(http.StatusInternalServerError)
+		isDebug = p.Options.RunMode == "dev"
+	)
+
+	if ir.IsHtmlRequest() {
+		if isDebug && p.Options.IsDebugPage {
+			ir.RenderDebugPage(http.StatusInternalServerError, err, stack)
+			return
+		}
+		ir.RenderErrorPage(http.StatusInternalServerError, errmsg, "")
+		return
+	}
+
+	if isDebug && p.Options.IsApiPanicStack {
+		ir.ApiOutputWithStatus(http.StatusInternalServerError, string(stack), CODE_ERR, fmt.Sprintf("%s: %v", errmsg, err))
+		return
+	}
+	ir.ApiOutputWithStatus(http.StatusInternalServerError, nil, CODE_ERR, errmsg)
+}
+
+// IsHtmlRequest reports whether the response should be a html page: the
+// handler started rendering a view, or the client asked for html first.
+func (p *Request) IsHtmlRequest() bool {
+	if p.isRenderingView {
+		return true
+	}
+	return strings.HasPrefix(p.R.Header.Get("Accept"), "text/html")
+}
+
+// RenderErrorPage writes a minimal html error page, detail is shown
+// preformatted when not empty.
+func (p *Request) RenderErrorPage(status int, title, detail string) {
+	p.W.Header().Set("Content-Type", "text/html;charset=utf-8")
+	p.W.Header().Set("Server", "iron")
+	p.W.WriteHeader(status)
+
+	title = html.EscapeString(title)
+	fmt.Fprintf(p.W, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%d %s</title></head><body>\n"+
+		"<h1>%d %s</h1>\n", status, title, status, title)
+	if detail != "" {
+		fmt.Fprintf(p.W, "<pre>%s</pre>\n", html.EscapeString(detail))
+	}
+	if p.Id != "" {
+		fmt.Fprintf(p.W, "<p><small>request id: %s</small></p>\n", html.EscapeString(p.Id))
+	}
+	fmt.Fprint(p.W, "</body></html>\n")
+}
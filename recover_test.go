@@ -0,0 +1,131 @@
+package iron
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlePanic(t *testing.T) {
+	var logWriter = log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(logWriter)
+
+	var serve = func(server *Server, path, accept string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		var r = httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept", accept)
+		server.httpMux.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, options := range []Options{
+		{RunMode: "dev"},
+		{RunMode: "dev", IsApiPanicStack: true, IsDebugPage: true},
+		{RunMode: "proc", IsApiPanicStack: true, IsDebugPage: true},
+	} {
+		var (
+			server        Server
+			recoverCount  int
+			isApiDetailed = options.RunMode == "dev" && options.IsApiPanicStack
+		)
+		AssertErrIsNil(server.Init(options))
+		server.Router("/panic", func(ir *Request) {
+			panic("secret boom")
+		})
+		server.Router("/custom", func(ir *Request) {
+			panic("custom boom")
+		})
+		server.HookErrorRecover(func(ir *Request, err interface{}) bool {
+			if ir.R.URL.Path == "/custom" {
+				ir.ApiOutputWithStatus(http.StatusTeapot, nil, CODE_ERR, "custom")
+				return false
+			}
+			return true
+		})
+		server.HookErrorRecover(func(ir *Request, err interface{}) bool {
+			recoverCount++
+			return true
+		})
+
+		var w = serve(&server, "/panic", "application/json")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.True(t, strings.HasPrefix(w.Body.String(), `{"Code":-1,"Error":"Internal Server Error`))
+		assert.Equal(t, isApiDetailed, strings.Contains(w.Body.String(), "secret boom"))
+		assert.Equal(t, isApiDetailed, strings.Contains(w.Body.String(), "goroutine"))
+
+		w = serve(&server, "/panic", "text/html,application/xhtml+xml")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "text/html;charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, options.RunMode == "dev" && options.IsDebugPage, strings.Contains(w.Body.String(), "secret boom"))
+
+		// the hook after the one answering still runs
+		w = serve(&server, "/custom", "")
+		assert.Equal(t, http.StatusTeapot, w.Code)
+		assert.Equal(t, `{"Code":-1,"Error":"custom","Data":null}`, w.Body.String())
+		assert.Equal(t, 3, recoverCount)
+	}
+}
+
+func TestRenderDebugPage(t *testing.T) {
+	var logWriter = log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(logWriter)
+
+	var viewDir, err = ioutil.TempDir("", "iron-debug")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(viewDir)
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(viewDir, "broken.html"),
+		[]byte("<? define \"Frame\" ?>\nline2\n<? if ?>x<? end ?>\n<? end ?>"), 0644))
+
+	for _, options := range []Options{
+		{RunMode: "dev", IsDebugPage: true},
+		{RunMode: "dev"},
+		{RunMode: "proc", IsDebugPage: true},
+	} {
+		var (
+			server  Server
+			isDebug = options.RunMode == "dev" && options.IsDebugPage
+		)
+		options.SiteViewDir = viewDir
+		AssertErrIsNil(server.Init(options))
+		server.AssignView("broken", "broken.html")
+		server.Router("/panic", func(ir *Request) {
+			ir.V["UserId"] = 42
+			ir.ViewData["PageTitle"] = "home"
+			panic("debug boom")
+		})
+		server.Router("/view", func(ir *Request) {
+			ir.Render("broken")
+		})
+
+		var w = httptest.NewRecorder()
+		var r = httptest.NewRequest("GET", "/panic?q=<script>", nil)
+		r.Header.Set("Accept", "text/html")
+		r.Header.Set("X-Debug-Header", "hello")
+		server.httpMux.ServeHTTP(w, r)
+
+		var body = w.Body.String()
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		for _, s := range []string{"debug boom", "recover_test.go", `panic(&#34;debug boom&#34;)`,
+			"X-Debug-Header", "UserId", "PageTitle", "&lt;script&gt;", "goroutine"} {
+			assert.Equal(t, isDebug, strings.Contains(body, s), s)
+		}
+		assert.False(t, strings.Contains(body, "<script>"))
+
+		w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/view", nil))
+		body = w.Body.String()
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, "text/html;charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, isDebug, strings.Contains(body, "broken.html:3"))
+		assert.Equal(t, isDebug, strings.Contains(body, "line2"))
+	}
+}
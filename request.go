@@ -1,40 +1,147 @@
 package iron
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/xerrors"
 )
 
+// RequestContext is the value passed as reqCtx to Proxy services and
+// hooks. Services declaring a context.Context as first param receive a
+// context.Context instead, see Request.Context.
 type RequestContext interface {
 }
 
+type requestContextKey struct{}
+
+// RequestFromContext returns the Request stored in ctx by Request.Init.
+func RequestFromContext(ctx context.Context) *Request {
+	ir, _ := ctx.Value(requestContextKey{}).(*Request)
+	return ir
+}
+
 type Request struct {
 	server   *Server
+	Id       string
 	RemoteIp string
 	W        http.ResponseWriter
 	R        *http.Request
+	Params   Params
 	V        map[string]interface{}
 	ViewData map[string]interface{}
 	Now      int64
+	StartAt  time.Time
+
+	rw              *responseWriter
+	compress        *compressWriter
+	session         *Session
+	isRenderingView bool
 }
 
 func (p *Request) Init(w http.ResponseWriter, r *http.Request) {
-	p.W = w
-	p.R = r
-	p.RemoteIp = strings.Split(r.RemoteAddr, ":")[0]
-	p.Now = time.Now().Local().Unix()
+	p.StartAt = time.Now()
+	p.rw = newResponseWriter(w)
+	p.W = exposeCapabilities(p.rw, w)
+	p.compress = nil
+	p.session = nil
+	if p.server != nil {
+		p.RemoteIp = p.server.ClientIp(r)
+		p.Id = p.server.RequestId(r)
+	} else {
+		p.RemoteIp = RemoteAddrIp(r.RemoteAddr)
+		p.Id = NewRequestId()
+	}
+	p.W.Header().Set(REQUEST_ID_HEADER, p.Id)
+
+	var ctx = context.WithValue(r.Context(), requestContextKey{}, p)
+	p.R = r.WithContext(WithRequestId(ctx, p.Id))
+	p.Now = p.StartAt.Local().Unix()
 	p.V = make(map[string]interface{})
 	p.ViewData = make(map[string]interface{})
 }
 
+// Context returns the context of the request, it is canceled when the
+// client goes away and carries the values set by SetValue.
+func (p *Request) Context() context.Context {
+	return p.R.Context()
+}
+
+// SetContext replaces the context of the request, e.g. to add a deadline.
+func (p *Request) SetContext(ctx context.Context) {
+	p.R = p.R.WithContext(ctx)
+}
+
+// SetValue stores a request scoped value in the request context.
+func (p *Request) SetValue(key, value interface{}) {
+	p.SetContext(context.WithValue(p.Context(), key, value))
+}
+
+// Value returns the request scoped value stored for key.
+func (p *Request) Value(key interface{}) interface{} {
+	return p.Context().Value(key)
+}
+
+// ResponseWriter returns the wrapped writer of the request, nil when W
+// was replaced by something else than the writer set up by Init.
+func (p *Request) ResponseWriter() ResponseWriter {
+	w, _ := p.W.(ResponseWriter)
+	return w
+}
+
+// Status returns the status code written so far, 0 if nothing has been
+// written yet.
+func (p *Request) Status() int {
+	if w := p.ResponseWriter(); w != nil {
+		return w.Status()
+	}
+	return 0
+}
+
+// BytesWritten returns the number of body bytes written so far.
+func (p *Request) BytesWritten() int64 {
+	if w := p.ResponseWriter(); w != nil {
+		return w.Size()
+	}
+	return 0
+}
+
+// IsHeaderWritten reports whether the response headers have been sent.
+func (p *Request) IsHeaderWritten() bool {
+	if w := p.ResponseWriter(); w != nil {
+		return w.IsHeaderWritten()
+	}
+	return false
+}
+
+// TimeToFirstByte returns the time between the request being initialized
+// and the response headers being sent, 0 if they have not been sent.
+func (p *Request) TimeToFirstByte() time.Duration {
+	if w := p.ResponseWriter(); w != nil && w.IsHeaderWritten() {
+		return w.FirstByteAt().Sub(p.StartAt)
+	}
+	return 0
+}
+
+// Elapsed returns the time spent since the request was initialized.
+func (p *Request) Elapsed() time.Duration {
+	return time.Since(p.StartAt)
+}
+
+// Param returns the value captured for key by the matched route pattern,
+// e.g. "id" for /user/:id.
+func (p *Request) Param(key string) string {
+	ret, _ := p.Params.Get(key)
+	return ret
+}
+
 func (p *Request) Redirect(url string) {
 	http.Redirect(p.W, p.R, url, 302)
 }
@@ -44,6 +151,26 @@ func (p *Request) ApiOutputSuccess(data interface{}) {
 }
 
 func (p *Request) ApiOutput(data interface{}, errno int, errmsg string) {
+	p.apiOutput(0, data, errno, errmsg)
+}
+
+// ApiOutputError outputs err with CODE_ERR, ValidationErrors returned by
+// Bind are put in Data so clients can point at the offending fields.
+func (p *Request) ApiOutputError(err error) {
+	var errs ValidationErrors
+	if xerrors.As(err, &errs) {
+		p.ApiOutput(errs, CODE_ERR, err.Error())
+		return
+	}
+	p.ApiOutput(nil, CODE_ERR, err.Error())
+}
+
+// ApiOutputWithStatus is ApiOutput with an explicit HTTP status code.
+func (p *Request) ApiOutputWithStatus(status int, data interface{}, errno int, errmsg string) {
+	p.apiOutput(status, data, errno, errmsg)
+}
+
+func (p *Request) apiOutput(status int, data interface{}, errno int, errmsg string) {
 	p.W.Header().Add("Server", "iron")
 	p.W.Header().Add("Content-Type", "application/json")
 	var ret = Response{
@@ -54,6 +181,9 @@ func (p *Request) ApiOutput(data interface{}, errno int, errmsg string) {
 		},
 	}
 	res, _ := json.Marshal(ret)
+	if status != 0 {
+		p.W.WriteHeader(status)
+	}
 	p.W.Write(res)
 }
 
@@ -62,12 +192,42 @@ func (p *Request) prepareForm() {
 		p.R.ParseForm()
 	}
 	if nil == p.R.MultipartForm {
-		p.R.ParseMultipartForm(32 << 20)
+		p.parseMultipartForm()
 	}
 }
 
-func (p *Request) Render(path string) {
-	p.server.Render(path, p.W, p.R, p.ViewData)
+// Render renders the view at path with ViewData and a 200, see
+// RenderStatus.
+func (p *Request) Render(path string) error {
+	return p.RenderStatus(http.StatusOK, path)
+}
+
+// RenderStatus renders the view at path with ViewData and status. When
+// it fails, the error is returned and a 500 error page is sent instead.
+func (p *Request) RenderStatus(status int, path string) error {
+	p.isRenderingView = true
+	p.addFlashesViewData()
+	var err = p.server.RenderStatus(status, path, p.W, p.R, p.ViewData)
+	if err != nil {
+		p.server.renderError(p.W, p.R, path, err)
+	}
+	return err
+}
+
+// RenderString renders the view at path with ViewData and returns the
+// output rather than sending it.
+func (p *Request) RenderString(path string) (string, error) {
+	p.addFlashesViewData()
+	return p.server.RenderString(path, p.ViewData)
+}
+
+// addFlashesViewData makes the session flashes available to views, e.g.
+// <? range call .Flashes "error" ?><? .Message ?><? end ?>, the session
+// is only loaded when the view calls it.
+func (p *Request) addFlashesViewData() {
+	if _, ok := p.ViewData["Flashes"]; !ok {
+		p.ViewData["Flashes"] = p.Flashes
+	}
 }
 
 func (p *Request) MustFormBytes(key string, defaultRet []byte) (ret []byte) {
@@ -185,6 +345,11 @@ func (p *Request) FormInt64(key string) (ret int64, err error) {
 	return ret, nil
 }
 
+// SaveFile stores the file of key in Server.UploadStorage as
+// newFileRelativePath, which must stay within the storage.
+//
+// Deprecated: use UploadFile, which checks the size and type of the file
+// and picks a random name.
 func (p *Request) SaveFile(key, newFileRelativePath string) (err error) {
 	p.prepareForm()
 	file, _, err := p.R.FormFile(key)
@@ -192,10 +357,8 @@ func (p *Request) SaveFile(key, newFileRelativePath string) (err error) {
 		return err
 	}
 	defer file.Close()
-	f, err := os.Create(fmt.Sprintf("%s/%s", p.server.Options.SiteStaticUploadBasePath, newFileRelativePath))
-	defer f.Close()
-	io.Copy(f, file)
-	return nil
+	_, err = p.server.UploadStorage.Save(newFileRelativePath, file)
+	return err
 }
 
 func (p *Request) DecodeBodyJSONData(ret interface{}) error {
@@ -0,0 +1,84 @@
+package iron
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+type requestIdContextKey struct{}
+
+// NewRequestId returns a 32 hex chars id: 48 bits of unix milliseconds,
+// so ids sort by time, followed by 80 random bits.
+func NewRequestId() string {
+	var b [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(b[:6], ms[2:])
+	if _, err := rand.Read(b[6:]); err != nil {
+		copy(b[6:], RandomCreateBytes(10))
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// isValidRequestId keeps incoming ids short and free of characters which
+// would break log lines.
+func isValidRequestId(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		var c = id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestId returns the id of r: the incoming X-Request-Id when the peer
+// is a trusted proxy and the id looks sane, a new one otherwise.
+func (p *Server) RequestId(r *http.Request) string {
+	var id = r.Header.Get(REQUEST_ID_HEADER)
+	if isValidRequestId(id) && p.IsTrustedProxy(RemoteAddrIp(r.RemoteAddr)) {
+		return id
+	}
+	return NewRequestId()
+}
+
+// WithRequestId returns a copy of ctx carrying id, for Dispatch callers
+// outside of a http request.
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdContextKey{}, id)
+}
+
+// RequestIdFromContext returns the request id carried by reqCtx, which may
+// be a context.Context or the *RequestContext given to Proxy hooks and
+// services.
+func RequestIdFromContext(reqCtx RequestContext) string {
+	var ctx, ok = contextOf(reqCtx)
+	if !ok {
+		return ""
+	}
+	id, _ := ctx.Value(requestIdContextKey{}).(string)
+	return id
+}
+
+// contextOf unwraps reqCtx into a context.Context.
+func contextOf(reqCtx RequestContext) (context.Context, bool) {
+	switch v := reqCtx.(type) {
+	case context.Context:
+		return v, true
+	case *RequestContext:
+		if v != nil {
+			return contextOf(*v)
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,44 @@
+package iron
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestId(t *testing.T) {
+	var server Server
+	AssertErrIsNil(server.Init(Options{TrustedProxiesStr: "127.0.0.1"}))
+
+	var ids []string
+	server.Router("/", func(ir *Request) {
+		assert.Equal(t, ir.Id, RequestIdFromContext(ir.Context()))
+		var reqCtx RequestContext = ir.Context()
+		assert.Equal(t, ir.Id, RequestIdFromContext(&reqCtx))
+		ids = append(ids, ir.Id)
+	})
+
+	var serve = func(remoteAddr, id string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		var r = httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set(REQUEST_ID_HEADER, id)
+		server.httpMux.ServeHTTP(w, r)
+		return w
+	}
+
+	var w = serve("127.0.0.1:1", "upstream-id")
+	assert.Equal(t, "upstream-id", w.Header().Get(REQUEST_ID_HEADER))
+
+	w = serve("192.0.2.1:1", "spoofed-id")
+	assert.Equal(t, 32, len(w.Header().Get(REQUEST_ID_HEADER)))
+
+	w = serve("127.0.0.1:1", "bad id\n")
+	assert.Equal(t, 32, len(w.Header().Get(REQUEST_ID_HEADER)))
+
+	assert.Equal(t, 3, len(ids))
+	assert.Equal(t, "upstream-id", ids[0])
+	assert.NotEqual(t, ids[1], ids[2])
+	assert.Equal(t, "", RequestIdFromContext(nil))
+}
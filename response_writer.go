@@ -0,0 +1,293 @@
+package iron
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ResponseWriter is the http.ResponseWriter given to handlers as
+// Request.W, it records what the handler wrote so hooks can query it.
+// http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom are passed
+// through, Request.W implements each only when the underlying writer
+// does, so type assertions tell what the connection supports.
+type ResponseWriter interface {
+	http.ResponseWriter
+
+	// Status returns the status code sent, 0 if headers are not sent yet.
+	Status() int
+	// Size returns the number of body bytes written.
+	Size() int64
+	// FirstByteAt returns when headers were sent, zero if not sent yet.
+	FirstByteAt() time.Time
+	// IsHeaderWritten reports whether headers were sent.
+	IsHeaderWritten() bool
+	// Unwrap returns the underlying http.ResponseWriter, it is used by
+	// http.ResponseController.
+	Unwrap() http.ResponseWriter
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	firstByteAt time.Time
+	isHijacked  bool
+
+	beforeWriteHeader func() // run once before the final headers, e.g. to set cookies
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (p *responseWriter) WriteHeader(status int) {
+	if p.status != 0 || p.isHijacked {
+		return
+	}
+	// Informational headers may be sent several times before the final one.
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		p.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if f := p.beforeWriteHeader; f != nil {
+		p.beforeWriteHeader = nil
+		f()
+	}
+	p.status = status
+	p.firstByteAt = time.Now()
+	p.ResponseWriter.WriteHeader(status)
+}
+
+func (p *responseWriter) Write(b []byte) (int, error) {
+	if p.status == 0 {
+		p.WriteHeader(http.StatusOK)
+	}
+	n, err := p.ResponseWriter.Write(b)
+	p.size += int64(n)
+	return n, err
+}
+
+func (p *responseWriter) readFrom(src io.Reader) (int64, error) {
+	if p.status == 0 {
+		p.WriteHeader(http.StatusOK)
+	}
+	var (
+		n   int64
+		err error
+	)
+	if rf, ok := p.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(p.ResponseWriter, src)
+	}
+	p.size += n
+	return n, err
+}
+
+func (p *responseWriter) flush() {
+	if p.status == 0 {
+		p.WriteHeader(http.StatusOK)
+	}
+	if f, ok := p.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (p *responseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	var h, ok = p.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		p.isHijacked = true
+		if p.status == 0 {
+			p.status = http.StatusSwitchingProtocols
+			p.firstByteAt = time.Now()
+		}
+	}
+	return conn, rw, err
+}
+
+func (p *responseWriter) push(target string, opts *http.PushOptions) error {
+	if pusher, ok := p.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (p *responseWriter) Status() int {
+	return p.status
+}
+
+func (p *responseWriter) Size() int64 {
+	return p.size
+}
+
+func (p *responseWriter) FirstByteAt() time.Time {
+	return p.firstByteAt
+}
+
+func (p *responseWriter) IsHeaderWritten() bool {
+	return p.status != 0
+}
+
+func (p *responseWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
+
+// capableWriter is a ResponseWriter able to serve the optional interfaces
+// of http.ResponseWriter, see exposeCapabilities.
+type capableWriter interface {
+	ResponseWriter
+	flush()
+	hijack() (net.Conn, *bufio.ReadWriter, error)
+	push(target string, opts *http.PushOptions) error
+	readFrom(src io.Reader) (int64, error)
+}
+
+type writerFlusher struct{ w capableWriter }
+
+func (p writerFlusher) Flush() {
+	p.w.flush()
+}
+
+type writerHijacker struct{ w capableWriter }
+
+func (p writerHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return p.w.hijack()
+}
+
+type writerPusher struct{ w capableWriter }
+
+func (p writerPusher) Push(target string, opts *http.PushOptions) error {
+	return p.w.push(target, opts)
+}
+
+type writerReaderFrom struct{ w capableWriter }
+
+func (p writerReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	return p.w.readFrom(src)
+}
+
+// exposeCapabilities returns w implementing each of http.Flusher,
+// http.Hijacker, http.Pusher and io.ReaderFrom only when under does.
+func exposeCapabilities(w capableWriter, under http.ResponseWriter) ResponseWriter {
+	var (
+		_, isFlusher    = under.(http.Flusher)
+		_, isHijacker   = under.(http.Hijacker)
+		_, isPusher     = under.(http.Pusher)
+		_, isReaderFrom = under.(io.ReaderFrom)
+
+		f  = writerFlusher{w}
+		h  = writerHijacker{w}
+		pu = writerPusher{w}
+		rf = writerReaderFrom{w}
+	)
+
+	var capabilities = 0
+	for i, ok := range []bool{isFlusher, isHijacker, isPusher, isReaderFrom} {
+		if ok {
+			capabilities |= 1 << i
+		}
+	}
+	switch capabilities {
+	case 0:
+		return w
+	case 1:
+		return struct {
+			capableWriter
+			writerFlusher
+		}{w, f}
+	case 2:
+		return struct {
+			capableWriter
+			writerHijacker
+		}{w, h}
+	case 3:
+		return struct {
+			capableWriter
+			writerFlusher
+			writerHijacker
+		}{w, f, h}
+	case 4:
+		return struct {
+			capableWriter
+			writerPusher
+		}{w, pu}
+	case 5:
+		return struct {
+			capableWriter
+			writerFlusher
+			writerPusher
+		}{w, f, pu}
+	case 6:
+		return struct {
+			capableWriter
+			writerHijacker
+			writerPusher
+		}{w, h, pu}
+	case 7:
+		return struct {
+			capableWriter
+			writerFlusher
+			writerHijacker
+			writerPusher
+		}{w, f, h, pu}
+	case 8:
+		return struct {
+			capableWriter
+			writerReaderFrom
+		}{w, rf}
+	case 9:
+		return struct {
+			capableWriter
+			writerFlusher
+			writerReaderFrom
+		}{w, f, rf}
+	case 10:
+		return struct {
+			capableWriter
+			writerHijacker
+			writerReaderFrom
+		}{w, h, rf}
+	case 11:
+		return struct {
+			capableWriter
+			writerFlusher
+			writerHijacker
+			writerReaderFrom
+		}{w, f, h, rf}
+	case 12:
+		return struct {
+			capableWriter
+			writerPusher
+			writerReaderFrom
+		}{w, pu, rf}
+	case 13:
+		return struct {
+			capableWriter
+			writerFlusher
+			writerPusher
+			writerReaderFrom
+		}{w, f, pu, rf}
+	case 14:
+		return struct {
+			capableWriter
+			writerHijacker
+			writerPusher
+			writerReaderFrom
+		}{w, h, pu, rf}
+	default:
+		return struct {
+			capableWriter
+			writerFlusher
+			writerHijacker
+			writerPusher
+			writerReaderFrom
+		}{w, f, h, pu, rf}
+	}
+}
@@ -0,0 +1,75 @@
+package iron
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseWriter(t *testing.T) {
+	var (
+		rec = httptest.NewRecorder()
+		ir  Request
+	)
+	ir.Init(rec, httptest.NewRequest("GET", "/", nil))
+
+	assert.False(t, ir.IsHeaderWritten())
+	assert.Equal(t, time.Duration(0), ir.TimeToFirstByte())
+
+	ir.W.WriteHeader(http.StatusAccepted)
+	ir.W.WriteHeader(http.StatusInternalServerError)
+	ir.W.Write([]byte("hello"))
+	io.Copy(ir.W, bytes.NewBufferString(" world"))
+	ir.W.(http.Flusher).Flush()
+
+	assert.True(t, ir.IsHeaderWritten())
+	assert.True(t, ir.TimeToFirstByte() > 0)
+	assert.Equal(t, http.StatusAccepted, ir.Status())
+	assert.Equal(t, int64(len("hello world")), ir.BytesWritten())
+	assert.Equal(t, "hello world", rec.Body.String())
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, rec, http.ResponseWriter(ir.ResponseWriter().Unwrap()))
+
+	// the recorder neither hijacks, pushes nor reads from
+	var _, isHijacker = ir.W.(http.Hijacker)
+	var _, isPusher = ir.W.(http.Pusher)
+	var _, isReaderFrom = ir.W.(io.ReaderFrom)
+	assert.False(t, isHijacker)
+	assert.False(t, isPusher)
+	assert.False(t, isReaderFrom)
+}
+
+type hijackTestWriter struct {
+	*httptest.ResponseRecorder
+	isHijacked bool
+}
+
+func (p *hijackTestWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	p.isHijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseWriterCapabilities(t *testing.T) {
+	var (
+		under = &hijackTestWriter{ResponseRecorder: httptest.NewRecorder()}
+		ir    Request
+	)
+	ir.Init(under, httptest.NewRequest("GET", "/", nil))
+
+	var _, isFlusher = ir.W.(http.Flusher)
+	var _, isPusher = ir.W.(http.Pusher)
+	assert.True(t, isFlusher)
+	assert.False(t, isPusher)
+	_, _, err := ir.W.(http.Hijacker).Hijack()
+	assert.Nil(t, err)
+	assert.True(t, under.isHijacked)
+	assert.Equal(t, http.StatusSwitchingProtocols, ir.Status())
+	assert.NotNil(t, ir.ResponseWriter())
+}
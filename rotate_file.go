@@ -0,0 +1,177 @@
+package iron
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// RotateFile is an append-only log file rotated once it grows past
+// MaxSize bytes or once the Interval boundary it was opened in has passed.
+// Rotated files are renamed with a timestamp suffix and gzipped in the
+// background when Compress is set, Close waits for them to finish.
+type RotateFile struct {
+	Path     string
+	MaxSize  int64
+	Interval time.Duration
+	Compress bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	gzipWg   sync.WaitGroup
+}
+
+func (p *RotateFile) Init(path string, maxSize int64, interval time.Duration, compress bool) error {
+	p.Path = path
+	p.MaxSize = maxSize
+	p.Interval = interval
+	p.Compress = compress
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.open()
+}
+
+func (p *RotateFile) open() error {
+	var file, err = os.OpenFile(p.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	var info os.FileInfo
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return err
+	}
+	p.file = file
+	p.size = info.Size()
+	p.openedAt = time.Now()
+	return nil
+}
+
+func (p *RotateFile) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if p.isShouldRotate(int64(len(b))) {
+		if err := p.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := p.file.Write(b)
+	p.size += int64(n)
+	return n, err
+}
+
+func (p *RotateFile) isShouldRotate(writeLen int64) bool {
+	if p.MaxSize > 0 && p.size > 0 && p.size+writeLen > p.MaxSize {
+		return true
+	}
+	if p.Interval > 0 && !time.Now().Truncate(p.Interval).Equal(p.openedAt.Truncate(p.Interval)) {
+		return true
+	}
+	return false
+}
+
+// Rotate closes the current file, moves it aside and opens a new one.
+func (p *RotateFile) Rotate() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rotate()
+}
+
+func (p *RotateFile) rotate() error {
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+
+	var rotatedPath = p.Path + "." + time.Now().Format("20060102-150405")
+	for i := 1; FileExists(rotatedPath) || FileExists(rotatedPath+".gz"); i++ {
+		rotatedPath = fmt.Sprintf("%s.%s.%d", p.Path, time.Now().Format("20060102-150405"), i)
+	}
+
+	if err := os.Rename(p.Path, rotatedPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if p.Compress {
+		p.gzipWg.Add(1)
+		go func() {
+			defer p.gzipWg.Done()
+			if err := gzipFile(rotatedPath); err != nil {
+				log.Println("compress rotated file error, err:", err)
+			}
+		}()
+	}
+
+	return p.open()
+}
+
+// Reopen closes and reopens the file at Path, for use after an external
+// tool such as logrotate moved it.
+func (p *RotateFile) Reopen() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+	return p.open()
+}
+
+// Close closes the file and waits for the rotated files being compressed.
+func (p *RotateFile) Close() error {
+	p.mu.Lock()
+	var err error
+	if p.file != nil {
+		err = p.file.Close()
+		p.file = nil
+	}
+	p.mu.Unlock()
+
+	p.gzipWg.Wait()
+	return err
+}
+
+// gzipFile compresses path into path.gz and removes path.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(path+".gz.tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		src.Close()
+		return err
+	}
+
+	var gz = gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	src.Close()
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz.tmp")
+		return err
+	}
+
+	if err = os.Rename(path+".gz.tmp", path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
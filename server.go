@@ -1,11 +1,14 @@
 package iron
 
 import (
+	"context"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
 	"net/http/fcgi"
-	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -17,10 +20,22 @@ type Server struct {
 	httpsServer         *http.Server
 	httpMux             *ServeMux
 	isClosedAfterHandle bool
+	isShuttingDown      int32
+	inflightCount       int64
+	shutdownDone        chan struct{}
 
 	NotFoundHandler Handler
 	Hook            Hook
+	AccessControl   AccessControl
 	views           map[string]*View
+	ViewFS          fs.FS // views root, e.g. fs.Sub of an embed.FS, SiteViewDir when nil
+	StaticFS        fs.FS // static files root, SiteStaticBasePath when nil
+	templateFuncs   map[string]interface{}
+	viewMu          sync.RWMutex // guards the parsed views and templateFuncs
+	assets          assetHashes
+	UploadStorage   UploadStorage // LocalUploadStorage of SiteStaticUploadBasePath by default
+	SessionStore    SessionStore  // MemorySessionStore by default
+	accessLogger    *AccessLogger
 
 	ImgExts []string
 
@@ -36,9 +51,14 @@ func (p *Server) Init(options Options) error {
 	}
 
 	p.views = make(map[string]*View)
+	p.templateFuncs = make(map[string]interface{})
+	p.initTemplateFuncs()
 	p.httpMux = p.NewServeMux()
+	p.Static("/static", nil, StaticOptions{})
 
 	p.ImgExts = []string{"jpeg", "gif", "png", "jpg"}
+	p.UploadStorage = &LocalUploadStorage{Dir: p.Options.SiteStaticUploadBasePath}
+	p.SessionStore = &MemorySessionStore{}
 
 	initEncoder()
 
@@ -48,21 +68,47 @@ func (p *Server) Init(options Options) error {
 	p.Hook.ErrorRecovers = make([]HookErrorRecover, 0)
 	p.Hook.AfterHttpHandles = make([]HookAfterHttpHandle, 0)
 	p.Hook.UrlRewrite = make([]HookUrlRewrite, 0)
+	p.Hook.Shutdowns = make([]HookShutdown, 0)
 
-	p.HookBeforeServeRequest("", p.HookAccessWhiteListRequest)
+	p.isShuttingDown = 0
+	p.shutdownDone = make(chan struct{})
+
+	err = p.AccessControl.Set("", p.Options.AccessWhiteListStr, p.Options.AccessBlackListStr)
+	if err != nil {
+		return err
+	}
+	p.HookBeforeServeRequest("", p.HookAccessControlRequest)
+
+	if p.Options.AccessLogPath != "" {
+		if p.accessLogger != nil {
+			p.accessLogger.Close()
+		}
+		p.accessLogger = &AccessLogger{}
+		if err = p.accessLogger.Init(p.Options); err != nil {
+			return err
+		}
+		p.HookAfterHttpHandle("", p.HookAccessLog)
+		p.HookShutdown(func() {
+			p.accessLogger.Close()
+		})
+	}
 
 	p.httpServer = &http.Server{
-		Handler:        p.httpMux,
-		ReadTimeout:    90 * time.Second,
-		WriteTimeout:   90 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+		Handler:           p.httpMux,
+		ReadTimeout:       p.Options.ReadTimeout,
+		ReadHeaderTimeout: p.Options.ReadHeaderTimeout,
+		WriteTimeout:      p.Options.WriteTimeout,
+		IdleTimeout:       p.Options.IdleTimeout,
+		MaxHeaderBytes:    p.Options.MaxHeaderBytes,
 	}
 
 	p.httpsServer = &http.Server{
-		Handler:        p.httpMux,
-		ReadTimeout:    90 * time.Second,
-		WriteTimeout:   90 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+		Handler:           p.httpMux,
+		ReadTimeout:       p.Options.ReadTimeout,
+		ReadHeaderTimeout: p.Options.ReadHeaderTimeout,
+		WriteTimeout:      p.Options.WriteTimeout,
+		IdleTimeout:       p.Options.IdleTimeout,
+		MaxHeaderBytes:    p.Options.MaxHeaderBytes,
 	}
 
 	http2.ConfigureServer(p.httpServer, &http2.Server{})
@@ -87,25 +133,41 @@ func (p *Server) SetCloseAfterHandle() {
 	p.isClosedAfterHandle = true
 }
 
-func (p *Server) HookAccessWhiteListRequest(ir *Request) bool {
-	if nil == p.Options.AccessWhiteList {
-		return true
+func (p *Server) HookAccessLog(ir *Request) bool {
+	if p.accessLogger != nil {
+		p.accessLogger.Log(ir)
 	}
-
-	for _, value := range p.Options.AccessWhiteList {
-		if isOk, _ := regexp.MatchString(value, ir.RemoteIp); true == isOk {
-			return true
-		}
-	}
-
-	Handle404(ir)
-	return false
+	return true
 }
 
 func (p *Server) Router(path string, handler func(*Request)) {
 	p.httpMux.HandleFunc(path, handler)
 }
 
+func (p *Server) RouterMethod(method, path string, handler func(*Request)) {
+	p.httpMux.HandleMethodFunc(method, path, handler)
+}
+
+func (p *Server) GET(path string, handler func(*Request)) {
+	p.httpMux.GET(path, handler)
+}
+
+func (p *Server) POST(path string, handler func(*Request)) {
+	p.httpMux.POST(path, handler)
+}
+
+func (p *Server) PUT(path string, handler func(*Request)) {
+	p.httpMux.PUT(path, handler)
+}
+
+func (p *Server) DELETE(path string, handler func(*Request)) {
+	p.httpMux.DELETE(path, handler)
+}
+
+func (p *Server) PATCH(path string, handler func(*Request)) {
+	p.httpMux.PATCH(path, handler)
+}
+
 func (p *Server) HandlerToServeHTTPFunc(handler func(*Request)) func(http.ResponseWriter, *http.Request) {
 	h := &HandleFunc{p, handler}
 	return h.ServeHTTP
@@ -116,6 +178,18 @@ func (p *Server) Serve() error {
 
 	p.isClosedAfterHandle = false
 
+	// broken views fail the start rather than their first request
+	if err = p.LoadViews(); err != nil {
+		return err
+	}
+	// as do unreadable static files, the working directory is not hashed
+	// when no static root is set
+	if p.StaticFS != nil || p.Options.SiteStaticBasePath != "" {
+		if err = p.LoadAssets(); err != nil {
+			return err
+		}
+	}
+
 	p.NetListener, err = net.Listen("tcp", p.Options.ListenStr)
 	if nil != err {
 		return err
@@ -124,7 +198,10 @@ func (p *Server) Serve() error {
 	switch p.Options.ServeType {
 	case "fcgi":
 		log.Println("Server started (fcgi), listen at:", p.Options.ListenStr)
-		fcgi.Serve(p.NetListener, p.httpMux)
+		err = fcgi.Serve(p.NetListener, p.httpMux)
+		if p.IsShuttingDown() {
+			err = nil
+		}
 
 	case "server":
 
@@ -160,20 +237,99 @@ func (p *Server) Serve() error {
 
 		for i := 0; i < serveCount; i++ {
 			tmpErr := <-retChan
-			if tmpErr != nil {
+			if tmpErr != nil && tmpErr != http.ErrServerClosed {
 				log.Println("web server serve error, err:", tmpErr)
 				err = tmpErr
 			}
 		}
 	}
 
+	// http.Server.Serve returns as soon as Shutdown is called, wait for
+	// in-flight requests and shutdown hooks before reporting closed.
+	if p.IsShuttingDown() {
+		<-p.shutdownDone
+	}
+
 	log.Println("Server closed.")
 
-	return nil
+	return err
+}
 
+// IsShuttingDown reports whether Shutdown has been called.
+func (p *Server) IsShuttingDown() bool {
+	return atomic.LoadInt32(&p.isShuttingDown) == 1
 }
 
+// Shutdown gracefully stops the server: listeners stop accepting new
+// connections, in-flight requests are given until ctx is done to finish,
+// then the shutdown hooks run and Serve returns.
+func (p *Server) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&p.isShuttingDown, 0, 1) {
+		select {
+		case <-p.shutdownDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer close(p.shutdownDone)
+
+	var err error
+
+	switch p.Options.ServeType {
+	case "fcgi":
+		if p.NetListener != nil {
+			p.NetListener.Close()
+		}
+
+	case "server":
+		var retChan = make(chan error, 2)
+		for _, srv := range []*http.Server{p.httpServer, p.httpsServer} {
+			go func(retChan chan<- error, srv *http.Server) {
+				retChan <- srv.Shutdown(ctx)
+			}(retChan, srv)
+		}
+		for i := 0; i < 2; i++ {
+			if tmpErr := <-retChan; tmpErr != nil {
+				err = tmpErr
+			}
+		}
+	}
+
+	if tmpErr := p.waitInflight(ctx); tmpErr != nil && err == nil {
+		err = tmpErr
+	}
+
+	for _, h := range p.Hook.Shutdowns {
+		h()
+	}
+
+	return err
+}
+
+// waitInflight polls the in-flight counter rather than using a
+// sync.WaitGroup, fcgi connections may still deliver requests while waiting.
+func (p *Server) waitInflight(ctx context.Context) error {
+	var ticker = time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&p.inflightCount) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Close stops the server immediately without waiting for in-flight requests.
 func (p *Server) Close() error {
-	p.NetListener.Close()
+	if p.Options.ServeType == "server" {
+		p.httpsServer.Close()
+		p.httpServer.Close()
+	}
+	if p.NetListener != nil {
+		p.NetListener.Close()
+	}
 	return nil
 }
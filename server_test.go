@@ -0,0 +1,79 @@
+package iron
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestServerShutdown(t *testing.T) {
+	var (
+		serverPort   = 17210
+		server       Server
+		isHookCalled bool
+		serveRetChan = make(chan error, 1)
+		err          error
+	)
+
+	var options Options
+	options.ListenStr = fmt.Sprintf("127.0.0.1:%v", serverPort)
+	AssertErrIsNil(server.Init(options))
+
+	server.Router("/Slow", func(ir *Request) {
+		time.Sleep(time.Millisecond * 300)
+		ir.ApiOutputSuccess("done")
+	})
+	server.HookShutdown(func() {
+		isHookCalled = true
+	})
+
+	go func() {
+		serveRetChan <- server.Serve()
+	}()
+	time.Sleep(time.Millisecond * 200)
+
+	var respChan = make(chan string, 1)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%v/Slow", serverPort))
+		if err != nil {
+			respChan <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		respBytes, _ := ioutil.ReadAll(resp.Body)
+		respChan <- string(respBytes)
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	assert.NoError(t, err)
+	assert.True(t, isHookCalled)
+
+	assert.Equal(t, `{"Code":0,"Error":"success","Data":"done"}`, <-respChan)
+	assert.NoError(t, <-serveRetChan)
+}
+
+func TestServerServeLoadFailed(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "iron-serve")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(dir)
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{
+		ServeType:          "server",
+		ListenStr:          "127.0.0.1:17211",
+		SiteStaticBasePath: filepath.Join(dir, "missing"),
+	}))
+	err = server.Serve()
+	assert.True(t, xerrors.Is(err, os.ErrNotExist), "%v", err)
+}
@@ -0,0 +1,520 @@
+package iron
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	SESSION_COOKIE_NAME_DEFAULT = "IRONSESSID"
+	SESSION_MAX_AGE_DEFAULT     = 24 * time.Hour
+	SESSION_COOKIE_MAX_LEN      = 4000 // browsers drop cookies over 4096 bytes
+	SESSION_GC_INTERVAL         = 10 * time.Minute
+	SESSION_FLASH_KEY           = "_flash"
+)
+
+// SessionStore keeps session values behind the token sent as the session
+// cookie, see CookieSessionStore, MemorySessionStore and
+// FileSessionStore. Values are encoded with gob, custom types need
+// gob.Register.
+type SessionStore interface {
+	// Load returns the values behind token, ErrSessionNotFound when there
+	// are none or they expired.
+	Load(token string) (map[string]interface{}, error)
+	// Save stores values for maxAge and returns the token to send, a new
+	// one when token is "".
+	Save(token string, values map[string]interface{}, maxAge time.Duration) (string, error)
+	Delete(token string) error
+}
+
+// Flash is a message kept in the session until read, e.g. to be shown
+// after a redirect.
+type Flash struct {
+	Category string
+	Message  string
+}
+
+// Session holds the values of a client across requests, see
+// Request.Session. It is not safe for concurrent use.
+type Session struct {
+	token         string
+	values        map[string]interface{}
+	isCookieSent  bool // the request came with a session cookie
+	isDirty       bool
+	isRegenerated bool
+}
+
+func (p *Session) Get(key string) interface{} {
+	return p.values[key]
+}
+
+func (p *Session) Set(key string, value interface{}) {
+	if value == nil {
+		p.Delete(key)
+		return
+	}
+	p.values[key] = value
+	p.isDirty = true
+}
+
+func (p *Session) Delete(key string) {
+	if _, ok := p.values[key]; ok {
+		delete(p.values, key)
+		p.isDirty = true
+	}
+}
+
+// Regenerate moves the values to a new token, the old one is dropped.
+// Call it on login and privilege changes against session fixation.
+func (p *Session) Regenerate() {
+	p.isRegenerated = true
+	p.isDirty = true
+}
+
+// Destroy drops every value and the token, the cookie is expired.
+func (p *Session) Destroy() {
+	p.values = make(map[string]interface{})
+	p.Regenerate()
+}
+
+func (p *Session) AddFlash(category, message string) {
+	var flashes, _ = p.values[SESSION_FLASH_KEY].([]Flash)
+	p.Set(SESSION_FLASH_KEY, append(flashes, Flash{category, message}))
+}
+
+// Flashes returns and removes the flashes of categories, of any category
+// when none is given.
+func (p *Session) Flashes(categories ...string) []Flash {
+	var (
+		flashes, _ = p.values[SESSION_FLASH_KEY].([]Flash)
+		ret        []Flash
+		kept       []Flash
+	)
+	for _, flash := range flashes {
+		if len(categories) == 0 || StringIsIn(flash.Category, categories) {
+			ret = append(ret, flash)
+		} else {
+			kept = append(kept, flash)
+		}
+	}
+	if len(kept) == 0 {
+		p.Delete(SESSION_FLASH_KEY)
+	} else if len(ret) > 0 {
+		p.Set(SESSION_FLASH_KEY, kept)
+	}
+	return ret
+}
+
+// clone returns a copy of the session sharing no value with it, values
+// are copied through gob as a store would.
+func (p *Session) clone() *Session {
+	var ret = *p
+	ret.values = make(map[string]interface{}, len(p.values))
+	if content, err := Encode(p.values); err == nil {
+		Decode(content, &ret.values)
+	} else {
+		// saving fails the same way, keep the values for it to report
+		for key, value := range p.values {
+			ret.values[key] = value
+		}
+	}
+	return &ret
+}
+
+// Session returns the session of the request, loaded from
+// Server.SessionStore on first use. It is saved when modified, just
+// before the response headers are sent, or at the end of the request.
+func (p *Request) Session() *Session {
+	if p.session != nil {
+		return p.session
+	}
+
+	p.session = &Session{values: make(map[string]interface{})}
+	if cookie, err := p.R.Cookie(p.server.Options.SessionCookieName); err == nil && cookie.Value != "" {
+		p.session.isCookieSent = true
+		var values map[string]interface{}
+		if values, err = p.server.SessionStore.Load(cookie.Value); err == nil {
+			p.session.token, p.session.values = cookie.Value, values
+		} else if !xerrors.Is(err, ErrSessionNotFound) {
+			log.Println("request id:", p.Id, ", session load failed, err:", err)
+		}
+	}
+	if p.rw != nil {
+		p.rw.beforeWriteHeader = p.saveSession
+	}
+	return p.session
+}
+
+// Flashes returns and removes the session flashes of categories, it is
+// the Flashes func of ViewData.
+func (p *Request) Flashes(categories ...string) []Flash {
+	return p.Session().Flashes(categories...)
+}
+
+// saveSession stores a modified session and sets its cookie, which is
+// only possible while the response headers are not sent.
+func (p *Request) saveSession() {
+	var session = p.session
+	if session == nil || !session.isDirty {
+		return
+	}
+	session.isDirty = false
+
+	var (
+		store   = p.server.SessionStore
+		options = p.server.Options
+		token   = session.token
+		err     error
+	)
+	if session.isRegenerated && token != "" {
+		if err = store.Delete(token); err != nil && !xerrors.Is(err, ErrSessionNotFound) {
+			log.Println("request id:", p.Id, ", session delete failed, err:", err)
+		}
+		token = ""
+	}
+	session.isRegenerated = false
+
+	var cookie = &http.Cookie{
+		Name:     options.SessionCookieName,
+		Path:     "/",
+		Domain:   options.SessionCookieDomain,
+		Secure:   options.IsSessionCookieSecure,
+		HttpOnly: true,
+		SameSite: options.SessionSameSite,
+	}
+	if len(session.values) == 0 {
+		if token != "" {
+			store.Delete(token)
+		}
+		session.token = ""
+		if !session.isCookieSent {
+			return
+		}
+		cookie.MaxAge = -1
+	} else {
+		if token, err = store.Save(token, session.values, options.SessionMaxAge); err != nil {
+			log.Println("request id:", p.Id, ", session save failed, err:", err)
+			return
+		}
+		session.token = token
+		session.isCookieSent = true
+		cookie.Value = token
+		cookie.MaxAge = int(options.SessionMaxAge / time.Second)
+	}
+
+	if p.rw != nil && p.rw.IsHeaderWritten() {
+		log.Println("request id:", p.Id, ", session cookie not sent, headers already written")
+		return
+	}
+	http.SetCookie(p.W, cookie)
+}
+
+var sessionIdRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func newSessionId() (string, error) {
+	var random = make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// encodeSession prefixes the gob of values with their expiry.
+func encodeSession(values map[string]interface{}, expireAt time.Time) ([]byte, error) {
+	var content, err = Encode(values)
+	if err != nil {
+		return nil, err
+	}
+	var ret = make([]byte, 8, 8+len(content))
+	binary.BigEndian.PutUint64(ret, uint64(expireAt.Unix()))
+	return append(ret, content...), nil
+}
+
+func decodeSession(content []byte) (map[string]interface{}, error) {
+	if len(content) < 8 {
+		return nil, ErrSessionInvalid
+	}
+	if time.Now().Unix() >= int64(binary.BigEndian.Uint64(content)) {
+		return nil, ErrSessionNotFound
+	}
+	var values map[string]interface{}
+	if err := Decode(content[8:], &values); err != nil {
+		return nil, xerrors.Errorf("%w, err:%v", ErrSessionInvalid, err)
+	}
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	return values, nil
+}
+
+// CookieSessionStore keeps the values in the cookie itself, encrypted and
+// authenticated with AES-GCM. There is nothing to delete server side, a
+// cookie stays valid until it expires.
+type CookieSessionStore struct {
+	Secrets []string // the first encrypts, all decrypt, for key rotation
+}
+
+func cookieSessionAEAD(secret string) (cipher.AEAD, error) {
+	var key = sha256.Sum256([]byte(secret))
+	var block, err = aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p *CookieSessionStore) Load(token string) (map[string]interface{}, error) {
+	var sealed, err = base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, xerrors.Errorf("%w, err:%v", ErrSessionInvalid, err)
+	}
+	for _, secret := range p.Secrets {
+		var aead cipher.AEAD
+		if aead, err = cookieSessionAEAD(secret); err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			break
+		}
+		var content []byte
+		if content, err = aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil); err == nil {
+			return decodeSession(content)
+		}
+	}
+	return nil, ErrSessionInvalid
+}
+
+func (p *CookieSessionStore) Save(token string, values map[string]interface{}, maxAge time.Duration) (string, error) {
+	if len(p.Secrets) == 0 {
+		return "", ErrSessionSecretMissing
+	}
+	var aead, err = cookieSessionAEAD(p.Secrets[0])
+	if err != nil {
+		return "", err
+	}
+	var content []byte
+	if content, err = encodeSession(values, time.Now().Add(maxAge)); err != nil {
+		return "", err
+	}
+	var nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, content, nil))
+	if len(token) > SESSION_COOKIE_MAX_LEN {
+		return "", xerrors.Errorf("%w, len:%d", ErrSessionTooLarge, len(token))
+	}
+	return token, nil
+}
+
+func (p *CookieSessionStore) Delete(token string) error {
+	return nil
+}
+
+// MemorySessionStore keeps the values in memory, they are lost on
+// restart. Expired sessions are evicted by GC, run by Save every
+// SESSION_GC_INTERVAL.
+type MemorySessionStore struct {
+	mu      sync.Mutex
+	entries map[string]memorySessionEntry
+	gcAt    time.Time
+}
+
+type memorySessionEntry struct {
+	content  []byte
+	expireAt time.Time
+}
+
+func (p *MemorySessionStore) Load(token string) (map[string]interface{}, error) {
+	p.mu.Lock()
+	var entry, ok = p.entries[token]
+	p.mu.Unlock()
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return decodeSession(entry.content)
+}
+
+func (p *MemorySessionStore) Save(token string, values map[string]interface{}, maxAge time.Duration) (string, error) {
+	var err error
+	if token == "" {
+		if token, err = newSessionId(); err != nil {
+			return "", err
+		}
+	}
+
+	// stored encoded, so no slice or map is shared with the request
+	var expireAt = time.Now().Add(maxAge)
+	var content []byte
+	if content, err = encodeSession(values, expireAt); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	if p.entries == nil {
+		p.entries = make(map[string]memorySessionEntry)
+	}
+	p.entries[token] = memorySessionEntry{content, expireAt}
+	var isGC = time.Since(p.gcAt) >= SESSION_GC_INTERVAL
+	p.mu.Unlock()
+
+	if isGC {
+		p.GC()
+	}
+	return token, nil
+}
+
+func (p *MemorySessionStore) Delete(token string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.entries, token)
+	return nil
+}
+
+// GC evicts the expired sessions.
+func (p *MemorySessionStore) GC() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var now = time.Now()
+	p.gcAt = now
+	for token, entry := range p.entries {
+		if !now.Before(entry.expireAt) {
+			delete(p.entries, token)
+		}
+	}
+}
+
+// FileSessionStore keeps each session in a file of Dir, written
+// atomically and readable by the owner only. Expired files are removed by
+// GC, run in the background by Save every SESSION_GC_INTERVAL.
+type FileSessionStore struct {
+	Dir string
+
+	mu   sync.Mutex
+	gcAt time.Time
+}
+
+// writeFile writes content to the file of token through a temp file
+// renamed over it, Dir is created 0700 and the file is 0600.
+func (p *FileSessionStore) writeFile(token string, content []byte) error {
+	var err error
+	if err = os.MkdirAll(p.Dir, 0700); err != nil {
+		return err
+	}
+
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(p.Dir, ".session-*"); err != nil {
+		return err
+	}
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(p.Dir, token))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (p *FileSessionStore) Load(token string) (map[string]interface{}, error) {
+	if !sessionIdRegexp.MatchString(token) {
+		return nil, ErrSessionInvalid
+	}
+	var content, err = ioutil.ReadFile(filepath.Join(p.Dir, token))
+	if os.IsNotExist(err) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeSession(content)
+}
+
+func (p *FileSessionStore) Save(token string, values map[string]interface{}, maxAge time.Duration) (string, error) {
+	var err error
+	if token == "" {
+		if token, err = newSessionId(); err != nil {
+			return "", err
+		}
+	} else if !sessionIdRegexp.MatchString(token) {
+		return "", ErrSessionInvalid
+	}
+
+	var content []byte
+	if content, err = encodeSession(values, time.Now().Add(maxAge)); err != nil {
+		return "", err
+	}
+	if err = p.writeFile(token, content); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	var isGC = time.Since(p.gcAt) >= SESSION_GC_INTERVAL
+	if isGC {
+		p.gcAt = time.Now()
+	}
+	p.mu.Unlock()
+	if isGC {
+		go p.GC()
+	}
+	return token, nil
+}
+
+func (p *FileSessionStore) Delete(token string) error {
+	if !sessionIdRegexp.MatchString(token) {
+		return ErrSessionInvalid
+	}
+	var err = os.Remove(filepath.Join(p.Dir, token))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// GC removes the expired session files.
+func (p *FileSessionStore) GC() error {
+	var entries, err = ioutil.ReadDir(p.Dir)
+	if err != nil {
+		return err
+	}
+	var (
+		now    = time.Now().Unix()
+		header = make([]byte, 8)
+	)
+	for _, entry := range entries {
+		if !sessionIdRegexp.MatchString(entry.Name()) {
+			continue
+		}
+		var filename = filepath.Join(p.Dir, entry.Name())
+		var f, err = os.Open(filename)
+		if err != nil {
+			continue
+		}
+		var n, _ = f.Read(header)
+		f.Close()
+		if n == 8 && now >= int64(binary.BigEndian.Uint64(header)) {
+			os.Remove(filename)
+		}
+	}
+	return nil
+}
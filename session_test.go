@@ -0,0 +1,276 @@
+package iron
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+func newSessionTestServer(store SessionStore) *Server {
+	var server = &Server{}
+	AssertErrIsNil(server.Init(Options{RunMode: "test"}))
+	if store != nil {
+		server.SessionStore = store
+	}
+	server.Router("/login", func(ir *Request) {
+		ir.Session().Regenerate()
+		ir.Session().Set("user", ir.MustFormString("user", ""))
+		ir.W.Write([]byte("ok"))
+	})
+	server.Router("/me", func(ir *Request) {
+		var user, _ = ir.Session().Get("user").(string)
+		ir.W.Write([]byte(user))
+	})
+	server.Router("/logout", func(ir *Request) {
+		ir.Session().Destroy()
+	})
+	server.Router("/anonymous", func(ir *Request) {
+		ir.Session().Get("user")
+		ir.W.Write([]byte("ok"))
+	})
+	return server
+}
+
+func sessionTestGet(server *Server, target string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	var r = httptest.NewRequest("GET", target, nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	var w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, r)
+	for _, item := range w.Result().Cookies() {
+		if item.Name == SESSION_COOKIE_NAME_DEFAULT {
+			return w, item
+		}
+	}
+	return w, nil
+}
+
+func TestSession(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "iron-session")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(dir)
+
+	for name, store := range map[string]SessionStore{
+		"memory": &MemorySessionStore{},
+		"file":   &FileSessionStore{Dir: dir},
+		"cookie": &CookieSessionStore{Secrets: []string{"secret"}},
+	} {
+		var server = newSessionTestServer(store)
+
+		var w, cookie = sessionTestGet(server, "/anonymous", nil)
+		assert.Equal(t, "ok", w.Body.String(), name)
+		assert.Nil(t, cookie, name)
+
+		// an unknown token is never adopted
+		var forged = &http.Cookie{Name: SESSION_COOKIE_NAME_DEFAULT, Value: strings.Repeat("a", 64)}
+		w, cookie = sessionTestGet(server, "/login?user=iron", forged)
+		assert.NotNil(t, cookie, name)
+		assert.NotEqual(t, forged.Value, cookie.Value, name)
+		assert.True(t, cookie.HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+		assert.Equal(t, int(SESSION_MAX_AGE_DEFAULT/time.Second), cookie.MaxAge)
+
+		var loggedIn = cookie
+		w, cookie = sessionTestGet(server, "/me", loggedIn)
+		assert.Equal(t, "iron", w.Body.String(), name)
+		assert.Nil(t, cookie, "unchanged session saved, %s", name)
+
+		// the token changes on login, the old one is dropped
+		w, cookie = sessionTestGet(server, "/login?user=admin", loggedIn)
+		assert.NotEqual(t, loggedIn.Value, cookie.Value, name)
+		if name != "cookie" {
+			w, _ = sessionTestGet(server, "/me", loggedIn)
+			assert.Equal(t, "", w.Body.String(), name)
+		}
+		loggedIn = cookie
+
+		w, cookie = sessionTestGet(server, "/logout", loggedIn)
+		assert.Equal(t, -1, cookie.MaxAge, name)
+		if name != "cookie" {
+			w, _ = sessionTestGet(server, "/me", loggedIn)
+			assert.Equal(t, "", w.Body.String(), name)
+		}
+	}
+}
+
+func TestSessionStoreExpiry(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "iron-session")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(dir)
+
+	var values = map[string]interface{}{"user": "iron", "id": 3}
+	var memory = &MemorySessionStore{}
+	var file = &FileSessionStore{Dir: dir}
+	for name, store := range map[string]SessionStore{
+		"memory": memory,
+		"file":   file,
+		"cookie": &CookieSessionStore{Secrets: []string{"secret"}},
+	} {
+		var token, err = store.Save("", values, time.Hour)
+		assert.Nil(t, err, name)
+		var loaded map[string]interface{}
+		loaded, err = store.Load(token)
+		assert.Nil(t, err, name)
+		assert.Equal(t, values, loaded, name)
+
+		token, err = store.Save("", values, -time.Second)
+		assert.Nil(t, err, name)
+		_, err = store.Load(token)
+		assert.True(t, xerrors.Is(err, ErrSessionNotFound), "%s %v", name, err)
+	}
+
+	memory.GC()
+	assert.Equal(t, 1, len(memory.entries))
+	assert.Nil(t, file.GC())
+	var files, _ = filepath.Glob(filepath.Join(dir, "*"))
+	assert.Equal(t, 1, len(files))
+
+	_, err = file.Load("../../etc/passwd")
+	assert.True(t, xerrors.Is(err, ErrSessionInvalid))
+}
+
+func TestFileSessionStoreMode(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "iron-session")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(dir)
+
+	var store = &FileSessionStore{Dir: filepath.Join(dir, "sessions")}
+	var token string
+	token, err = store.Save("", map[string]interface{}{"user": "iron"}, time.Hour)
+	AssertErrIsNil(err)
+
+	var info os.FileInfo
+	info, err = os.Stat(store.Dir)
+	AssertErrIsNil(err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(store.Dir, token))
+	AssertErrIsNil(err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	AssertErrIsNil(store.Delete(token))
+	var files, _ = filepath.Glob(filepath.Join(store.Dir, "*"))
+	assert.Equal(t, 0, len(files))
+}
+
+func TestCookieSessionStore(t *testing.T) {
+	var old = &CookieSessionStore{Secrets: []string{"old"}}
+	var token, err = old.Save("", map[string]interface{}{"user": "iron"}, time.Hour)
+	AssertErrIsNil(err)
+
+	// rotated secrets still read cookies of the previous one
+	var rotated = &CookieSessionStore{Secrets: []string{"new", "old"}}
+	var values map[string]interface{}
+	values, err = rotated.Load(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "iron", values["user"])
+
+	_, err = (&CookieSessionStore{Secrets: []string{"other"}}).Load(token)
+	assert.True(t, xerrors.Is(err, ErrSessionInvalid))
+	var tampered = []byte(token)
+	tampered[len(tampered)/2] ^= 1
+	_, err = rotated.Load(string(tampered))
+	assert.True(t, xerrors.Is(err, ErrSessionInvalid))
+
+	_, err = (&CookieSessionStore{}).Save("", map[string]interface{}{"user": "iron"}, time.Hour)
+	assert.True(t, xerrors.Is(err, ErrSessionSecretMissing))
+	_, err = old.Save("", map[string]interface{}{"user": strings.Repeat("x", SESSION_COOKIE_MAX_LEN)}, time.Hour)
+	assert.True(t, xerrors.Is(err, ErrSessionTooLarge))
+}
+
+func TestSessionFlashes(t *testing.T) {
+	var logWriter = log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(logWriter)
+
+	var viewDir, err = ioutil.TempDir("", "iron-view")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(viewDir)
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(viewDir, "flash.html"),
+		[]byte(`<? define "Frame" ?><? range call .Flashes "error" ?>[<? .Message ?>]<? end ?><? end ?>`), 0644))
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "test", SiteViewDir: viewDir}))
+	server.AssignView("flash", "flash.html")
+	server.Router("/save", func(ir *Request) {
+		ir.Session().AddFlash("error", "<b>failed</b>")
+		ir.Session().AddFlash("info", "saved")
+		http.Redirect(ir.W, ir.R, "/show", http.StatusFound)
+	})
+	server.Router("/show", func(ir *Request) {
+		ir.Render("flash")
+	})
+	server.Router("/info", func(ir *Request) {
+		for _, flash := range ir.Flashes() {
+			ir.W.Write([]byte(flash.Category + ":" + flash.Message))
+		}
+	})
+
+	var w, cookie = sessionTestGet(&server, "/save", nil)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.NotNil(t, cookie)
+
+	w, _ = sessionTestGet(&server, "/show", cookie)
+	assert.Equal(t, "[&lt;b&gt;failed&lt;/b&gt;]", w.Body.String())
+	w, _ = sessionTestGet(&server, "/show", cookie)
+	assert.Equal(t, "", w.Body.String())
+
+	// the last flash is read, the emptied session expires the cookie
+	var expired *http.Cookie
+	w, expired = sessionTestGet(&server, "/info", cookie)
+	assert.Equal(t, "info:saved", w.Body.String())
+	assert.Equal(t, -1, expired.MaxAge)
+}
+
+func TestSessionOptions(t *testing.T) {
+	var server Server
+	assert.NotNil(t, server.Init(Options{RunMode: "test", SessionSameSiteStr: "loose"}))
+	assert.NotNil(t, server.Init(Options{RunMode: "test", SessionMaxAgeStr: "-1h"}))
+	assert.Nil(t, server.Init(Options{RunMode: "test", SessionSameSiteStr: "Strict", SessionMaxAgeStr: "30m"}))
+	assert.Equal(t, http.SameSiteStrictMode, server.Options.SessionSameSite)
+	assert.Equal(t, 30*time.Minute, server.Options.SessionMaxAge)
+}
+
+func TestSessionTimeoutHandler(t *testing.T) {
+	var server = newSessionTestServer(nil)
+	server.Router("/timeout/login", TimeoutHandler(time.Second, func(ir *Request) {
+		ir.Session().Set("user", "iron")
+		ir.Session().AddFlash("info", "welcome")
+		ir.W.Write([]byte("ok"))
+	}))
+
+	var w, cookie = sessionTestGet(server, "/timeout/login", nil)
+	assert.Equal(t, "ok", w.Body.String())
+	assert.NotNil(t, cookie)
+
+	w, _ = sessionTestGet(server, "/me", cookie)
+	assert.Equal(t, "iron", w.Body.String())
+}
+
+func TestMemorySessionStoreCopy(t *testing.T) {
+	var store MemorySessionStore
+	var token, err = store.Save("", map[string]interface{}{
+		SESSION_FLASH_KEY: make([]Flash, 1, 4),
+	}, time.Minute)
+	AssertErrIsNil(err)
+
+	var first, second map[string]interface{}
+	first, err = store.Load(token)
+	AssertErrIsNil(err)
+	second, err = store.Load(token)
+	AssertErrIsNil(err)
+
+	// appending within the capacity of one copy must not show in another
+	var flashes = append(first[SESSION_FLASH_KEY].([]Flash)[:1], Flash{"info", "a"})
+	flashes[0].Message = "changed"
+	assert.Equal(t, []Flash{{}}, second[SESSION_FLASH_KEY])
+}
@@ -0,0 +1,299 @@
+package iron
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticOptions configures a static mount, see Server.Static.
+type StaticOptions struct {
+	CacheControl    map[string]string // Cache-Control by extension, e.g. ".css", "*" for the others
+	IsListDir       bool              // list directories which have no index.html
+	IsSPA           bool              // serve the root index.html for missing paths without extension
+	IsPrecompressed bool              // serve .br and .gz siblings to clients accepting them
+}
+
+type staticMount struct {
+	prefix  string
+	fsys    fs.FS // nil means Server.staticFS
+	options StaticOptions
+	etags   sync.Map // staticETagKey -> string
+}
+
+type staticETagKey struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+var staticEncodings = []struct {
+	ext      string
+	encoding string
+}{{".br", "br"}, {".gz", "gzip"}}
+
+// Static serves the files of fsys under the URL path prefix, a nil fsys
+// serves StaticFS or SiteStaticBasePath, also under fingerprinted names,
+// see AssetUrl. Paths with a segment starting with "." are never served.
+// A prefix already mounted is replaced, the longest matching prefix wins,
+// and requests for missing files fall through to the routes.
+func (p *Server) Static(prefix string, fsys fs.FS, options StaticOptions) {
+	prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+
+	var mux = p.httpMux
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	var statics []*staticMount
+	for _, mount := range mux.statics {
+		if mount.prefix != prefix {
+			statics = append(statics, mount)
+		}
+	}
+	statics = append(statics, &staticMount{prefix: prefix, fsys: fsys, options: options})
+	sort.SliceStable(statics, func(i, j int) bool {
+		return len(statics[i].prefix) > len(statics[j].prefix)
+	})
+	mux.statics = statics
+}
+
+// RemoveStatic drops the static mount at prefix.
+func (p *Server) RemoveStatic(prefix string) {
+	prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+
+	var mux = p.httpMux
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	var statics []*staticMount
+	for _, mount := range mux.statics {
+		if mount.prefix != prefix {
+			statics = append(statics, mount)
+		}
+	}
+	mux.statics = statics
+}
+
+// serveStatic serves ir from the static mount matching its path, it
+// reports false when there is nothing to serve.
+func (mux *ServeMux) serveStatic(ir *Request) bool {
+	if ir.R.Method != http.MethodGet && ir.R.Method != http.MethodHead {
+		return false
+	}
+
+	var urlPath = ir.R.URL.Path
+	mux.mu.RLock()
+	var statics = mux.statics
+	mux.mu.RUnlock()
+
+	for _, mount := range statics {
+		if urlPath == mount.prefix || strings.HasPrefix(urlPath, mount.prefix+"/") {
+			return mount.serve(mux.server, ir, urlPath[len(mount.prefix):])
+		}
+	}
+	return false
+}
+
+func (p *staticMount) serve(server *Server, ir *Request, name string) bool {
+	var fsys = p.fsys
+	if fsys == nil {
+		fsys = server.staticFS()
+	}
+
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if isHiddenPath(name) {
+		return false
+	}
+	if name == "" {
+		name = "."
+	}
+
+	var isFingerprinted = false
+	if p.fsys == nil {
+		if original, ok := server.resolveAsset(fsys, name); ok {
+			name, isFingerprinted = original, true
+		}
+	}
+
+	var info, err = fs.Stat(fsys, name)
+	if err != nil {
+		if p.options.IsSPA && path.Ext(name) == "" {
+			if info, err = fs.Stat(fsys, "index.html"); err == nil && info.Mode().IsRegular() {
+				return p.serveFile(fsys, ir, "index.html", info)
+			}
+		}
+		return false
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(ir.R.URL.Path, "/") {
+			http.Redirect(ir.W, ir.R, path.Base(ir.R.URL.Path)+"/", http.StatusMovedPermanently)
+			return true
+		}
+		var index = path.Join(name, "index.html")
+		if indexInfo, err := fs.Stat(fsys, index); err == nil && indexInfo.Mode().IsRegular() {
+			return p.serveFile(fsys, ir, index, indexInfo)
+		}
+		if p.options.IsListDir {
+			return p.listDir(fsys, ir, name)
+		}
+		return false
+	}
+
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	if isFingerprinted {
+		ir.W.Header().Set("Cache-Control", ASSET_CACHE_CONTROL)
+	}
+	return p.serveFile(fsys, ir, name, info)
+}
+
+func (p *staticMount) serveFile(fsys fs.FS, ir *Request, name string, info fs.FileInfo) bool {
+	var (
+		header     = ir.W.Header()
+		servedName = name
+		encoding   string
+	)
+
+	if p.options.IsPrecompressed {
+		header.Add("Vary", "Accept-Encoding")
+		var acceptEncoding = ir.R.Header.Get("Accept-Encoding")
+		for _, item := range staticEncodings {
+			if !acceptsEncoding(acceptEncoding, item.encoding) {
+				continue
+			}
+			if encodedInfo, err := fs.Stat(fsys, name+item.ext); err == nil && encodedInfo.Mode().IsRegular() {
+				servedName, encoding, info = name+item.ext, item.encoding, encodedInfo
+				break
+			}
+		}
+	}
+
+	var f, err = fsys.Open(servedName)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var rs, ok = f.(io.ReadSeeker)
+	if !ok {
+		return false
+	}
+
+	var etag string
+	if etag, err = p.etag(servedName, info, rs); err != nil {
+		return false
+	}
+
+	var ext = path.Ext(name)
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		header.Set("Content-Type", contentType)
+	} else if encoding != "" {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	if header.Get("Cache-Control") == "" {
+		// unless set by serve for fingerprinted assets
+		if cacheControl, ok := p.options.CacheControl[ext]; ok {
+			header.Set("Cache-Control", cacheControl)
+		} else if cacheControl, ok = p.options.CacheControl["*"]; ok {
+			header.Set("Cache-Control", cacheControl)
+		}
+	}
+	header.Set("ETag", etag)
+
+	http.ServeContent(ir.W, ir.R, name, info.ModTime(), rs)
+	return true
+}
+
+// etag is the strong ETag of the file, the hash of its content, cached
+// as long as the file keeps its size and modification time.
+func (p *staticMount) etag(name string, info fs.FileInfo, rs io.ReadSeeker) (string, error) {
+	var key = staticETagKey{name, info.Size(), info.ModTime()}
+	if etag, ok := p.etags.Load(key); ok {
+		return etag.(string), nil
+	}
+
+	var h = sha256.New()
+	if _, err := io.Copy(h, rs); err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	var etag = `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	p.etags.Store(key, etag)
+	return etag, nil
+}
+
+func (p *staticMount) listDir(fsys fs.FS, ir *Request, name string) bool {
+	var entries, err = fs.ReadDir(fsys, name)
+	if err != nil {
+		return false
+	}
+
+	ir.W.Header().Set("Content-Type", "text/html;charset=utf-8")
+	fmt.Fprint(ir.W, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"></head><body>\n<pre>\n")
+	for _, entry := range entries {
+		var entryName = entry.Name()
+		if isHiddenPath(entryName) {
+			continue
+		}
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		var link = url.URL{Path: entryName}
+		fmt.Fprintf(ir.W, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(entryName))
+	}
+	fmt.Fprint(ir.W, "</pre>\n</body></html>\n")
+	return true
+}
+
+// isHiddenPath reports whether a segment of the slash separated name
+// starts with ".".
+func isHiddenPath(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header value lists
+// encoding, or "*", without q=0.
+func acceptsEncoding(header, encoding string) bool {
+	for _, item := range strings.Split(header, ",") {
+		var (
+			parts = strings.Split(item, ";")
+			name  = strings.TrimSpace(parts[0])
+		)
+		if name != encoding && name != "*" {
+			continue
+		}
+		var isRefused = false
+		for _, param := range parts[1:] {
+			param = strings.Replace(param, " ", "", -1)
+			if param == "q=0" || strings.HasPrefix(param, "q=0.") && strings.Trim(param[4:], "0") == "" {
+				isRefused = true
+			}
+		}
+		if !isRefused {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package iron
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatic(t *testing.T) {
+	var files = fstest.MapFS{
+		"index.html":      {Data: []byte("spa")},
+		"css/site.css":    {Data: []byte("body{}")},
+		"css/site.css.gz": {Data: []byte("gzipped")},
+		"js/app.js":       {Data: []byte("app")},
+		".env":            {Data: []byte("secret")},
+		"js/.git/config":  {Data: []byte("secret")},
+	}
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "proc"}))
+	server.Static("/assets", files, StaticOptions{
+		CacheControl:    map[string]string{".css": "max-age=31536000", "*": "no-cache"},
+		IsPrecompressed: true,
+	})
+	server.Static("/app/", files, StaticOptions{IsSPA: true, IsListDir: true})
+	server.Router("/", func(ir *Request) {
+		ir.ApiOutputWithStatus(http.StatusNotFound, nil, CODE_ERR, "route")
+	})
+
+	var serve = func(path string, header ...string) *httptest.ResponseRecorder {
+		var w = httptest.NewRecorder()
+		var r = httptest.NewRequest("GET", path, nil)
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		server.httpMux.ServeHTTP(w, r)
+		return w
+	}
+
+	var w = serve("/assets/css/site.css")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "body{}", w.Body.String())
+	assert.Equal(t, "max-age=31536000", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	var etag = w.Header().Get("ETag")
+	assert.Equal(t, 34, len(etag))
+
+	w = serve("/assets/css/site.css", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = serve("/assets/css/site.css", "Accept-Encoding", "br;q=0, gzip")
+	assert.Equal(t, "gzipped", w.Body.String())
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/css"))
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	w = serve("/assets/js/app.js")
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	for _, path := range []string{"/assets/.env", "/assets/js/.git/config", "/assets/missing.js", "/assets/js/"} {
+		w = serve(path)
+		assert.Equal(t, `{"Code":-1,"Error":"route","Data":null}`, w.Body.String(), path)
+	}
+
+	w = serve("/app/js/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `<a href="app.js">app.js</a>`))
+	assert.False(t, strings.Contains(w.Body.String(), ".git"))
+
+	w = serve("/app/js")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/app/js/", w.Header().Get("Location"))
+
+	w = serve("/app/users/42")
+	assert.Equal(t, "spa", w.Body.String())
+	w = serve("/app/missing.js")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	server.RemoveStatic("/app")
+	w = serve("/app/users/42")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestStaticBeforeParamRoute(t *testing.T) {
+	var files = fstest.MapFS{
+		"a.css": {Data: []byte("body{}")},
+	}
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "proc"}))
+	server.Static("/static", files, StaticOptions{})
+	server.GET("/*path", func(ir *Request) {
+		ir.W.Write([]byte("catch-all:" + ir.Param("path")))
+	})
+	server.GET("/static/:name/edit", func(ir *Request) {
+		ir.W.Write([]byte("param:" + ir.Param("name")))
+	})
+	server.GET("/static/exact.css", func(ir *Request) {
+		ir.W.Write([]byte("exact"))
+	})
+
+	for path, body := range map[string]string{
+		"/static/a.css":      "body{}",
+		"/static/exact.css":  "exact",
+		"/static/a.css/edit": "param:a.css",
+		"/static/missing.js": "catch-all:static/missing.js",
+		"/users/42":          "catch-all:users/42",
+	} {
+		var w = serveMuxForTest(&server, "", path)
+		assert.Equal(t, body, w.Body.String(), path)
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	assert.True(t, acceptsEncoding("gzip, deflate, br", "br"))
+	assert.True(t, acceptsEncoding("*", "gzip"))
+	assert.True(t, acceptsEncoding("gzip;q=0.5", "gzip"))
+	assert.False(t, acceptsEncoding("gzip;q=0", "gzip"))
+	assert.False(t, acceptsEncoding("gzip; q=0.000", "gzip"))
+	assert.False(t, acceptsEncoding("deflate", "gzip"))
+}
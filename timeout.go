@@ -0,0 +1,118 @@
+package iron
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TimeoutHandler runs handler with a deadline: the request context is
+// canceled after timeout and, if handler has not returned by then, the
+// client gets a 503 with the CODE_TIMEOUT json envelope, as for a Proxy
+// service timeout. Output of handler is buffered until it returns, so it
+// should not stream.
+func TimeoutHandler(timeout time.Duration, handler func(*Request)) func(*Request) {
+	return func(ir *Request) {
+		var ctx, cancel = context.WithTimeout(ir.Context(), timeout)
+		defer cancel()
+
+		var (
+			tw        = &timeoutWriter{header: make(http.Header)}
+			irCopy    = *ir
+			doneChan  = make(chan struct{})
+			panicChan = make(chan interface{}, 1)
+		)
+		// handler works on a copy with its own maps so ir stays untouched
+		// if it outlives us.
+		irCopy.W = tw
+		irCopy.Params = append(Params(nil), ir.Params...)
+		irCopy.V = copyValues(ir.V)
+		irCopy.ViewData = copyValues(ir.ViewData)
+		irCopy.SetContext(context.WithValue(ctx, requestContextKey{}, &irCopy))
+		// its session is saved below, not by a hook on the writer of ir
+		irCopy.rw = nil
+		if ir.session != nil {
+			irCopy.session = ir.session.clone()
+		}
+
+		go func() {
+			defer recoverTo(panicChan)
+			handler(&irCopy)
+			close(doneChan)
+		}()
+
+		select {
+		case err := <-panicChan:
+			panic(err)
+
+		case <-doneChan:
+			// handler returned, what it set is visible to the after hooks
+			ir.V, ir.ViewData = irCopy.V, irCopy.ViewData
+			// the session cookie goes out with the headers copied below
+			irCopy.saveSession()
+			ir.session = irCopy.session
+
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			var dst = ir.W.Header()
+			for k, v := range tw.header {
+				dst[k] = v
+			}
+			if tw.status == 0 {
+				tw.status = http.StatusOK
+			}
+			ir.W.WriteHeader(tw.status)
+			ir.W.Write(tw.buf.Bytes())
+
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.isTimedOut = true
+			ir.ApiOutputWithStatus(http.StatusServiceUnavailable, nil, CODE_TIMEOUT, ErrTimeout.Error())
+		}
+	}
+}
+
+// timeoutWriter buffers the output of a TimeoutHandler handler.
+type timeoutWriter struct {
+	mu         sync.Mutex
+	header     http.Header
+	buf        bytes.Buffer
+	status     int
+	isTimedOut bool
+}
+
+func (p *timeoutWriter) Header() http.Header {
+	return p.header
+}
+
+func (p *timeoutWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.isTimedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if p.status == 0 {
+		p.status = http.StatusOK
+	}
+	return p.buf.Write(b)
+}
+
+func (p *timeoutWriter) WriteHeader(status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.isTimedOut || p.status != 0 {
+		return
+	}
+	p.status = status
+}
+
+func copyValues(src map[string]interface{}) map[string]interface{} {
+	var dst = make(map[string]interface{}, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,150 @@
+package iron
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	var server = prepareMuxServer()
+	var isCanceled = make(chan bool, 1)
+	server.GET("/fast", TimeoutHandler(time.Second, func(ir *Request) {
+		ir.W.Header().Set("X-Fast", "1")
+		ir.W.WriteHeader(http.StatusCreated)
+		ir.W.Write([]byte("fast"))
+	}))
+	server.GET("/slow", TimeoutHandler(time.Millisecond*50, func(ir *Request) {
+		<-ir.Context().Done()
+		isCanceled <- true
+		ir.W.Write([]byte("slow"))
+	}))
+
+	var w = serveMuxForTest(server, "", "/fast")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Fast"))
+	assert.Equal(t, "fast", w.Body.String())
+
+	w = serveMuxForTest(server, "", "/slow")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"Code":-2,"Error":"timeout.","Data":null}`, w.Body.String())
+	assert.True(t, <-isCanceled)
+}
+
+func TestTimeoutHandlerRequestCopy(t *testing.T) {
+	var ir Request
+	ir.Init(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	ir.V["k"] = "v"
+
+	TimeoutHandler(time.Second, func(c *Request) {
+		assert.True(t, RequestFromContext(c.Context()) == c)
+		assert.Equal(t, "v", c.V["k"])
+		c.V["fast"] = true
+	})(&ir)
+	assert.Equal(t, true, ir.V["fast"])
+
+	var isLate = make(chan bool)
+	TimeoutHandler(time.Millisecond*50, func(c *Request) {
+		<-c.Context().Done()
+		c.V["late"] = true
+		c.ViewData["late"] = true
+		close(isLate)
+	})(&ir)
+	<-isLate
+	assert.Nil(t, ir.V["late"])
+	assert.Nil(t, ir.ViewData["late"])
+}
+
+func ProxyServiceTestTimeout(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(time.Second):
+		return "done", nil
+	}
+}
+
+func TestProxyServiceTimeout(t *testing.T) {
+	var proxy Proxy
+	AssertErrIsNil(proxy.Init())
+	proxy.RegisterService("/TestTimeout", ProxyServiceTestTimeout)
+	proxy.SetServiceTimeout("/TestTimeout", time.Millisecond*50)
+
+	var resp = proxy.Dispatch("/TestTimeout", context.Background())
+	assert.Equal(t, Response{RespCommon{CODE_TIMEOUT, ErrTimeout.Error()}, nil}, resp)
+
+	// a service ignoring its context is not waited for
+	proxy.RegisterService("/TestSleep", func(ctx context.Context) (string, error) {
+		time.Sleep(time.Second)
+		return "done", nil
+	})
+	proxy.SetServiceTimeout("/TestSleep", time.Millisecond*50)
+	var startAt = time.Now()
+	resp = proxy.Dispatch("/TestSleep", context.Background())
+	assert.Equal(t, CODE_TIMEOUT, resp.(Response).Code)
+	assert.True(t, time.Since(startAt) < time.Millisecond*500)
+
+	var server = prepareMuxServer()
+	AssertErrIsNil(proxy.InitAttachModeWebServer("/api", server))
+	var w = serveMuxForTest(server, "", "/api/TestTimeout")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestProxyServiceCanceled(t *testing.T) {
+	var proxy Proxy
+	AssertErrIsNil(proxy.Init())
+	proxy.RegisterService("/TestSleep", func(ctx context.Context) (string, error) {
+		time.Sleep(time.Millisecond * 100)
+		return "done", nil
+	})
+	proxy.SetServiceTimeout("/TestSleep", time.Second)
+
+	// a cancelation which is not the deadline is not a timeout, the
+	// service is waited for
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	var resp = proxy.Dispatch("/TestSleep", ctx)
+	assert.Equal(t, Response{RespCommon{CODE_OK, ""}, "done"}, resp)
+}
+
+func timeoutTestPanic(ir *Request) {
+	panic("timeout boom")
+}
+
+func proxyServiceTestPanic(ctx context.Context) (string, error) {
+	panic("service boom")
+}
+
+func TestGoroutinePanicStack(t *testing.T) {
+	var logWriter = log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(logWriter)
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "dev", IsApiPanicStack: true}))
+	server.GET("/panic", TimeoutHandler(time.Second, timeoutTestPanic))
+
+	var proxy Proxy
+	AssertErrIsNil(proxy.Init())
+	proxy.RegisterService("/TestPanic", proxyServiceTestPanic)
+	proxy.SetServiceTimeout("/TestPanic", time.Second)
+	AssertErrIsNil(proxy.InitAttachModeWebServer("/api", &server))
+
+	// the stack is the one of the goroutine which panicked
+	var w = serveMuxForTest(&server, "", "/panic")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "timeout boom"))
+	assert.True(t, strings.Contains(w.Body.String(), "timeoutTestPanic"))
+
+	w = serveMuxForTest(&server, "", "/api/TestPanic")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "service boom"))
+	assert.True(t, strings.Contains(w.Body.String(), "proxyServiceTestPanic"))
+}
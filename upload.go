@@ -0,0 +1,329 @@
+package iron
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+const UPLOAD_MAX_SIZE_DEFAULT = 8 << 20 // bytes per file when UploadRule.MaxSize is 0
+
+// UploadStorage stores uploaded files under slash separated relative
+// names, see LocalUploadStorage and MemoryUploadStorage.
+type UploadStorage interface {
+	// Save stores the content of r as name, atomically: name is either
+	// the whole content or left untouched.
+	Save(name string, r io.Reader) (int64, error)
+	Open(name string) (io.ReadCloser, error)
+	Remove(name string) error
+}
+
+// CleanUploadName checks name is a clean relative path staying within
+// the storage, without hidden segments.
+func CleanUploadName(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "\\\x00") ||
+		path.IsAbs(name) || path.Clean(name) != name ||
+		name == ".." || strings.HasPrefix(name, "../") || isHiddenPath(name) {
+		return "", xerrors.Errorf("%w, name:%q", ErrUploadNameInvalid, name)
+	}
+	return name, nil
+}
+
+// LocalUploadStorage stores files under Dir, writing them to a temp file
+// renamed into place once complete.
+type LocalUploadStorage struct {
+	Dir string
+}
+
+func (p *LocalUploadStorage) path(name string) (string, error) {
+	var _, err = CleanUploadName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(p.Dir, filepath.FromSlash(name)), nil
+}
+
+func (p *LocalUploadStorage) Save(name string, r io.Reader) (int64, error) {
+	var filename, err = p.path(name)
+	if err != nil {
+		return 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return 0, err
+	}
+
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(filepath.Dir(filename), ".upload-*"); err != nil {
+		return 0, err
+	}
+	var n int64
+	if n, err = io.Copy(tmp, r); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+func (p *LocalUploadStorage) Open(name string) (io.ReadCloser, error) {
+	var filename, err = p.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filename)
+}
+
+func (p *LocalUploadStorage) Remove(name string) error {
+	var filename, err = p.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// MemoryUploadStorage keeps files in memory, for tests.
+type MemoryUploadStorage struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func (p *MemoryUploadStorage) Save(name string, r io.Reader) (int64, error) {
+	var _, err = CleanUploadName(name)
+	if err != nil {
+		return 0, err
+	}
+	var content []byte
+	if content, err = ioutil.ReadAll(r); err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.files == nil {
+		p.files = make(map[string][]byte)
+	}
+	p.files[name] = content
+	return int64(len(content)), nil
+}
+
+func (p *MemoryUploadStorage) Open(name string) (io.ReadCloser, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var content, ok = p.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (p *MemoryUploadStorage) Remove(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.files[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(p.files, name)
+	return nil
+}
+
+// UploadRule is what the files of a form field must satisfy.
+type UploadRule struct {
+	MaxSize    int64         // bytes per file, 0 means UPLOAD_MAX_SIZE_DEFAULT
+	MaxFiles   int           // files in the field, 0 means 1
+	Exts       []string      // allowed extensions, e.g. ".png", case insensitive, empty allows any
+	MimeTypes  []string      // allowed sniffed types or prefixes ending with "/", empty allows any
+	Dir        string        // storage directory of the files, "" for the root
+	IsOptional bool          // no error when the field has no file
+	Image      *ImageOptions // when set, files are images processed by ProcessImage before being stored
+}
+
+// UploadedFile describes a stored file.
+type UploadedFile struct {
+	Field        string
+	OriginalName string // as sent by the client, not to be trusted
+	Name         string // storage name
+	Size         int64
+	MimeType     string // sniffed from the content
+	Sha256       string // hex
+}
+
+var uploadExtRegexp = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// UploadFile stores the single file of field, see UploadFiles.
+func (p *Request) UploadFile(field string, rule UploadRule) (*UploadedFile, error) {
+	rule.MaxFiles = 1
+	var files, err = p.UploadFiles(field, rule)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+// UploadFiles checks the files of field against rule and stores them in
+// Server.UploadStorage under random names. On error nothing is left
+// stored.
+func (p *Request) UploadFiles(field string, rule UploadRule) ([]UploadedFile, error) {
+	if rule.MaxSize <= 0 {
+		rule.MaxSize = UPLOAD_MAX_SIZE_DEFAULT
+	}
+	if rule.MaxFiles <= 0 {
+		rule.MaxFiles = 1
+	}
+	var exts = make([]string, len(rule.Exts))
+	for i, ext := range rule.Exts {
+		exts[i] = strings.ToLower(ext)
+	}
+	rule.Exts = exts
+
+	if p.R.MultipartForm == nil {
+		if err := p.parseMultipartForm(); err != nil {
+			return nil, xerrors.Errorf("%w, field:%s, err:%v", ErrUploadInvalid, field, err)
+		}
+	}
+
+	var headers = p.R.MultipartForm.File[field]
+	if len(headers) == 0 {
+		if rule.IsOptional {
+			return nil, nil
+		}
+		return nil, xerrors.Errorf("%w, field:%s", ErrUploadMissing, field)
+	}
+	if len(headers) > rule.MaxFiles {
+		return nil, xerrors.Errorf("%w, field:%s", ErrUploadTooMany, field)
+	}
+
+	var ret []UploadedFile
+	for _, header := range headers {
+		var file, err = p.uploadFile(field, header, rule)
+		if err != nil {
+			for _, saved := range ret {
+				p.server.UploadStorage.Remove(saved.Name)
+			}
+			return nil, err
+		}
+		ret = append(ret, file)
+	}
+	return ret, nil
+}
+
+func (p *Request) uploadFile(field string, header *multipart.FileHeader, rule UploadRule) (UploadedFile, error) {
+	var ret = UploadedFile{Field: field, OriginalName: header.Filename}
+
+	if header.Size > rule.MaxSize {
+		return ret, xerrors.Errorf("%w, field:%s, file:%q", ErrUploadTooLarge, field, header.Filename)
+	}
+
+	var ext = strings.ToLower(path.Ext(strings.Replace(header.Filename, "\\", "/", -1)))
+	if !uploadExtRegexp.MatchString(ext) {
+		ext = ""
+	}
+	if len(rule.Exts) > 0 && !StringIsIn(ext, rule.Exts) {
+		return ret, xerrors.Errorf("%w, field:%s, file:%q", ErrUploadExtNotAllowed, field, header.Filename)
+	}
+
+	var f, err = header.Open()
+	if err != nil {
+		return ret, err
+	}
+	defer f.Close()
+
+	var head = make([]byte, 512)
+	var n int
+	if n, err = io.ReadFull(f, head); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ret, err
+	}
+	head = head[:n]
+	ret.MimeType = strings.TrimSpace(strings.Split(http.DetectContentType(head), ";")[0])
+	if len(rule.MimeTypes) > 0 && !isMimeTypeIn(ret.MimeType, rule.MimeTypes) {
+		return ret, xerrors.Errorf("%w, field:%s, file:%q, type:%s", ErrUploadTypeNotAllowed, field, header.Filename, ret.MimeType)
+	}
+
+	var r = io.LimitReader(io.MultiReader(bytes.NewReader(head), f), rule.MaxSize+1)
+	if rule.Image != nil {
+		// decoded and encoded again, which drops EXIF and the like
+		var (
+			content []byte
+			buf     bytes.Buffer
+			outExt  string
+		)
+		if content, err = ioutil.ReadAll(r); err != nil {
+			return ret, err
+		}
+		if int64(len(content)) > rule.MaxSize {
+			return ret, xerrors.Errorf("%w, field:%s, file:%q", ErrUploadTooLarge, field, header.Filename)
+		}
+		if outExt, err = ProcessImage(&buf, bytes.NewReader(content), *rule.Image); err != nil {
+			return ret, xerrors.Errorf("%w, field:%s, file:%q", err, field, header.Filename)
+		}
+		ext = "." + outExt
+		ret.MimeType = strings.TrimSpace(strings.Split(http.DetectContentType(buf.Bytes()), ";")[0])
+		r = &buf
+	}
+
+	var random = make([]byte, 16)
+	if _, err = rand.Read(random); err != nil {
+		return ret, err
+	}
+	ret.Name = path.Join(rule.Dir, hex.EncodeToString(random)+ext)
+
+	var h = sha256.New()
+	if ret.Size, err = p.server.UploadStorage.Save(ret.Name, io.TeeReader(r, h)); err != nil {
+		return ret, err
+	}
+	if rule.Image == nil && ret.Size > rule.MaxSize {
+		p.server.UploadStorage.Remove(ret.Name)
+		return ret, xerrors.Errorf("%w, field:%s, file:%q", ErrUploadTooLarge, field, header.Filename)
+	}
+	ret.Sha256 = hex.EncodeToString(h.Sum(nil))
+	return ret, nil
+}
+
+// parseMultipartForm parses a multipart body, at most
+// Options.UploadMaxBodySize MB of it, and keeps up to
+// Options.UploadMaxMemory MB in memory, the rest in temp files.
+func (p *Request) parseMultipartForm() error {
+	if !strings.HasPrefix(p.R.Header.Get("Content-Type"), "multipart/") {
+		return http.ErrNotMultipart
+	}
+	var maxMemory, maxBodySize int64 = 32, 0
+	if p.server != nil {
+		maxMemory, maxBodySize = p.server.Options.UploadMaxMemory, p.server.Options.UploadMaxBodySize
+	}
+	if maxBodySize > 0 {
+		p.R.Body = http.MaxBytesReader(p.W, p.R.Body, maxBodySize<<20)
+	}
+	return p.R.ParseMultipartForm(maxMemory << 20)
+}
+
+func isMimeTypeIn(mimeType string, mimeTypes []string) bool {
+	for _, item := range mimeTypes {
+		if item == mimeType || strings.HasSuffix(item, "/") && strings.HasPrefix(mimeType, item) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package iron
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+var uploadTestPng = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+
+func newUploadTestRequest(server *Server, files map[string][][2]string) *Request {
+	var body bytes.Buffer
+	var mw = multipart.NewWriter(&body)
+	for field, items := range files {
+		for _, item := range items {
+			fw, _ := mw.CreateFormFile(field, item[0])
+			fw.Write([]byte(item[1]))
+		}
+	}
+	mw.Close()
+
+	var r = httptest.NewRequest("POST", "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	var ir = &Request{server: server}
+	ir.Init(httptest.NewRecorder(), r)
+	return ir
+}
+
+func TestUploadFiles(t *testing.T) {
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "test"}))
+	var storage = &MemoryUploadStorage{}
+	server.UploadStorage = storage
+
+	var imageRule = UploadRule{
+		MaxSize:   1024,
+		MaxFiles:  2,
+		Exts:      []string{".png", ".jpg"},
+		MimeTypes: []string{"image/"},
+		Dir:       "avatar",
+	}
+
+	var ir = newUploadTestRequest(&server, map[string][][2]string{
+		"avatar": {{"../../etc/me.PNG", string(uploadTestPng)}, {"b.jpg", string(uploadTestPng)}},
+	})
+	var files, err = ir.UploadFiles("avatar", imageRule)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files))
+	var sum = sha256.Sum256(uploadTestPng)
+	assert.Regexp(t, `^avatar/[0-9a-f]{32}\.png$`, files[0].Name)
+	assert.Equal(t, "me.PNG", files[0].OriginalName)
+	assert.Equal(t, "image/png", files[0].MimeType)
+	assert.Equal(t, int64(len(uploadTestPng)), files[0].Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), files[0].Sha256)
+	assert.NotEqual(t, files[0].Name, files[1].Name)
+	var rc, _ = storage.Open(files[1].Name)
+	var content, _ = ioutil.ReadAll(rc)
+	assert.Equal(t, uploadTestPng, content)
+
+	for _, item := range []struct {
+		files map[string][][2]string
+		rule  UploadRule
+		err   error
+	}{
+		{map[string][][2]string{}, imageRule, ErrUploadMissing},
+		{map[string][][2]string{"avatar": {{"a.png", string(uploadTestPng)}, {"b.png", string(uploadTestPng)}}},
+			UploadRule{}, ErrUploadTooMany},
+		{map[string][][2]string{"avatar": {{"a.png", string(uploadTestPng)}}},
+			UploadRule{MaxSize: 10}, ErrUploadTooLarge},
+		{map[string][][2]string{"avatar": {{"a.exe", string(uploadTestPng)}}}, imageRule, ErrUploadExtNotAllowed},
+		{map[string][][2]string{"avatar": {{"a.png", "<html><script>"}}}, imageRule, ErrUploadTypeNotAllowed},
+		// the first file is removed when the second is refused
+		{map[string][][2]string{"avatar": {{"a.png", string(uploadTestPng)}, {"b.png", "text"}}}, imageRule, ErrUploadTypeNotAllowed},
+	} {
+		var before = len(storage.files)
+		ir = newUploadTestRequest(&server, item.files)
+		files, err = ir.UploadFiles("avatar", item.rule)
+		assert.True(t, xerrors.Is(err, item.err), "%v", err)
+		assert.Nil(t, files)
+		assert.Equal(t, before, len(storage.files))
+	}
+
+	// rule extensions are case insensitive too
+	var upperRule = UploadRule{Exts: []string{".PNG"}}
+	ir = newUploadTestRequest(&server, map[string][][2]string{"avatar": {{"a.png", string(uploadTestPng)}}})
+	files, err = ir.UploadFiles("avatar", upperRule)
+	assert.Nil(t, err)
+	assert.Regexp(t, `\.png$`, files[0].Name)
+	assert.Equal(t, []string{".PNG"}, upperRule.Exts)
+
+	ir = newUploadTestRequest(&server, nil)
+	var file *UploadedFile
+	file, err = ir.UploadFile("avatar", UploadRule{IsOptional: true})
+	assert.Nil(t, err)
+	assert.Nil(t, file)
+}
+
+func TestLocalUploadStorage(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "iron-upload")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(dir)
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "test", SiteStaticUploadBasePath: filepath.Join(dir, "upload")}))
+
+	for _, name := range []string{"../escape.txt", "/etc/passwd", "a/../../b", "a/./b", ".hidden", "a\\b", ""} {
+		_, err = server.UploadStorage.Save(name, strings.NewReader("x"))
+		assert.True(t, xerrors.Is(err, ErrUploadNameInvalid), name)
+	}
+
+	var n int64
+	n, err = server.UploadStorage.Save("doc/readme.txt", strings.NewReader("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	var content, _ = ioutil.ReadFile(filepath.Join(dir, "upload", "doc", "readme.txt"))
+	assert.Equal(t, "hello", string(content))
+	var entries, _ = ioutil.ReadDir(filepath.Join(dir, "upload", "doc"))
+	assert.Equal(t, 1, len(entries), "temp file left")
+	assert.Nil(t, server.UploadStorage.Remove("doc/readme.txt"))
+
+	var ir = newUploadTestRequest(&server, map[string][][2]string{"file": {{"a.txt", "legacy"}}})
+	assert.NotNil(t, ir.SaveFile("file", "../escape.txt"))
+	_, err = os.Stat(filepath.Join(dir, "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, ir.SaveFile("file", "legacy.txt"))
+	content, _ = ioutil.ReadFile(filepath.Join(dir, "upload", "legacy.txt"))
+	assert.Equal(t, "legacy", string(content))
+}
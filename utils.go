@@ -20,6 +20,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"golang.org/x/xerrors"
 )
 
 func SafePage(page int) int {
@@ -57,6 +59,8 @@ func Md5(src string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// HtmlSpecialchars escapes res for html by hand, views assigned by
+// AssignView are escaped by html/template already.
 func HtmlSpecialchars(res *string) {
 	*res = strings.Replace(*res, ">", "&gt;", -1)
 	*res = strings.Replace(*res, "<", "&lt;", -1)
@@ -82,6 +86,15 @@ func SqlEscape(res interface{}) string {
 	return "'" + ret + "'"
 }
 
+func IntIsIn(value int, arr []int) bool {
+	for _, v := range arr {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
 func Int64IsIn(value int64, arr []int64) bool {
 	for _, v := range arr {
 		if value == v {
@@ -102,6 +115,7 @@ func StringIsIn(value string, arr []string) bool {
 
 func initEncoder() {
 	gob.Register(map[string]interface{}{})
+	gob.Register([]Flash{})
 }
 
 func Encode(data interface{}) ([]byte, error) {
@@ -113,24 +127,30 @@ func Encode(data interface{}) ([]byte, error) {
 	case map[string]interface{}:
 		nd := map[string]interface{}(data.(map[string]interface{}))
 		for _, v := range nd {
-			gob.Register(v)
+			if v != nil {
+				gob.Register(v)
+			}
 		}
 		err = enc.Encode(nd)
 	case map[interface{}]interface{}:
 		nd := map[string]interface{}(data.(map[string]interface{}))
 		for _, v := range nd {
-			gob.Register(v)
+			if v != nil {
+				gob.Register(v)
+			}
 		}
 		err = enc.Encode(nd)
 	case []interface{}:
 		nd := []interface{}(data.([]interface{}))
 		for _, v := range nd {
-			gob.Register(v)
+			if v != nil {
+				gob.Register(v)
+			}
 		}
 		err = enc.Encode(nd)
 	default:
+		err = enc.Encode(data)
 	}
-	err = enc.Encode(data)
 
 	if err != nil {
 		return []byte(""), err
@@ -177,18 +197,26 @@ func imageDecode(fileext string, file io.Reader) (image.Image, error) {
 	case "gif":
 		return gif.Decode(file)
 	default:
-		return nil, nil
+		return nil, xerrors.Errorf("%w, ext:%s", ErrImageFormatNotSupported, fileext)
 	}
 }
 
-func imageEncode(fileext string, file io.Writer, img image.Image) {
+// imageEncode encodes img, quality only applies to jpeg, 0 means the
+// jpeg default.
+func imageEncode(fileext string, file io.Writer, img image.Image, quality int) error {
 	switch fileext {
 	case "jpg", "jpeg":
-		jpeg.Encode(file, img, nil)
+		var options *jpeg.Options
+		if quality > 0 {
+			options = &jpeg.Options{Quality: quality}
+		}
+		return jpeg.Encode(file, img, options)
 	case "png":
-		png.Encode(file, img)
+		return png.Encode(file, img)
 	case "gif":
-		gif.Encode(file, img, nil)
+		return gif.Encode(file, img, nil)
+	default:
+		return xerrors.Errorf("%w, ext:%s", ErrImageFormatNotSupported, fileext)
 	}
 }
 
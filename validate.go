@@ -0,0 +1,300 @@
+package iron
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// FieldError describes why a single field failed binding or validation.
+type FieldError struct {
+	Field   string `json:"Field"`
+	Rule    string `json:"Rule"`
+	Message string `json:"Message"`
+}
+
+// ValidationErrors is the list of field errors returned by Bind and
+// Validate, it marshals to a json array so ApiOutput can render it as Data.
+type ValidationErrors []FieldError
+
+func (p ValidationErrors) Error() string {
+	var arr = make([]string, 0, len(p))
+	for _, e := range p {
+		arr = append(arr, e.Field+" "+e.Message)
+	}
+	return strings.Join(arr, "; ")
+}
+
+// validateRule is a parsed rule of a `validate` tag.
+type validateRule struct {
+	name  string
+	arg   string
+	bound float64
+	words []string
+	reg   *regexp.Regexp
+}
+
+type validateFieldRules struct {
+	index       int
+	name        string
+	rules       []validateRule
+	isNested    bool
+	isAnonymous bool
+}
+
+type validateTypeRules struct {
+	fields []validateFieldRules
+	err    error
+}
+
+// validateTypeCache maps a struct type to its *validateTypeRules, tags are
+// parsed once per type.
+var validateTypeCache sync.Map
+
+// Validate checks the `validate` struct tags of dst, a struct or a pointer
+// to one. Rules are separated by ',':
+//
+//	required        value must not be the zero value
+//	omitempty       the following rules are skipped for the zero value
+//	min=N, max=N    bound on numbers, on length for strings and slices
+//	email           string must pass IsEmail
+//	oneof=a b c     value must be one of the space separated words
+//	regexp=EXPR     string must match EXPR, it takes the rest of the tag
+//	                so it must be the last rule
+//
+// Rules apply to zero values too, e.g. min=18 refuses 0, unless they
+// follow omitempty. A nil pointer passes every rule but required. A tag
+// that does not parse is a programming error, reported as
+// ErrValidateTagInvalid rather than ValidationErrors.
+func Validate(dst interface{}) error {
+	var v = reflect.ValueOf(dst)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs ValidationErrors
+	if err := validateStruct(v, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func getValidateTypeRules(t reflect.Type) *validateTypeRules {
+	if cached, ok := validateTypeCache.Load(t); ok {
+		return cached.(*validateTypeRules)
+	}
+
+	var ret = &validateTypeRules{}
+	for i := 0; i < t.NumField(); i++ {
+		var sf = t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		var field = validateFieldRules{
+			index:       i,
+			name:        bindFieldName(sf),
+			isAnonymous: sf.Anonymous,
+		}
+
+		if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+			var err error
+			if field.rules, err = parseValidateTag(tag); err != nil {
+				ret.err = xerrors.Errorf("%w, type:%s, field:%s, err:%v", ErrValidateTagInvalid, t, sf.Name, err)
+				break
+			}
+		}
+
+		var inner = sf.Type
+		for inner.Kind() == reflect.Ptr {
+			inner = inner.Elem()
+		}
+		field.isNested = inner.Kind() == reflect.Struct && inner != timeType
+
+		if len(field.rules) > 0 || field.isNested {
+			ret.fields = append(ret.fields, field)
+		}
+	}
+
+	var cached, _ = validateTypeCache.LoadOrStore(t, ret)
+	return cached.(*validateTypeRules)
+}
+
+func parseValidateTag(tag string) ([]validateRule, error) {
+	var rules []validateRule
+	for tag != "" {
+		var str string
+		if strings.HasPrefix(tag, "regexp=") {
+			str, tag = tag, ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			str, tag = tag[:i], tag[i+1:]
+		} else {
+			str, tag = tag, ""
+		}
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+
+		var rule = validateRule{name: str}
+		if i := strings.IndexByte(str, '='); i >= 0 {
+			rule.name, rule.arg = str[:i], str[i+1:]
+		}
+
+		var err error
+		switch rule.name {
+		case "required", "omitempty", "email":
+		case "min", "max":
+			rule.bound, err = strconv.ParseFloat(rule.arg, 64)
+		case "oneof":
+			rule.words = strings.Fields(rule.arg)
+		case "regexp":
+			rule.reg, err = regexp.Compile(rule.arg)
+		default:
+			err = xerrors.New("unknown rule")
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("rule:%s, err:%w", str, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) error {
+	var typeRules = getValidateTypeRules(v.Type())
+	if typeRules.err != nil {
+		return typeRules.err
+	}
+
+	for _, f := range typeRules.fields {
+		var (
+			field = v.Field(f.index)
+			name  = prefix + f.name
+		)
+
+		if len(f.rules) > 0 {
+			validateField(field, name, f.rules, errs)
+		}
+
+		if !f.isNested {
+			continue
+		}
+		for field.Kind() == reflect.Ptr && !field.IsNil() {
+			field = field.Elem()
+		}
+		if field.Kind() != reflect.Struct {
+			continue
+		}
+		var err error
+		if f.isAnonymous {
+			err = validateStruct(field, prefix, errs)
+		} else {
+			err = validateStruct(field, name+".", errs)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateField(v reflect.Value, name string, rules []validateRule, errs *ValidationErrors) {
+	var isZero = v.IsZero()
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	for _, rule := range rules {
+		switch rule.name {
+		case "required":
+			if isZero {
+				*errs = append(*errs, FieldError{name, rule.name, "is required"})
+				return
+			}
+			continue
+		case "omitempty":
+			if isZero {
+				return
+			}
+			continue
+		}
+
+		if v.Kind() == reflect.Ptr {
+			// nil, only required applies
+			return
+		}
+
+		var msg = checkValidateRule(v, rule)
+		if msg != "" {
+			*errs = append(*errs, FieldError{name, rule.name, msg})
+		}
+	}
+}
+
+// checkValidateRule returns the error message of rule on v, empty if v
+// passes it.
+func checkValidateRule(v reflect.Value, rule validateRule) string {
+	switch rule.name {
+	case "min", "max":
+		var (
+			value    float64
+			isLength bool
+		)
+		switch v.Kind() {
+		case reflect.String:
+			value, isLength = float64(utf8.RuneCountInString(v.String())), true
+		case reflect.Slice, reflect.Map, reflect.Array:
+			value, isLength = float64(v.Len()), true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			value = v.Float()
+		default:
+			return ""
+		}
+		var what = "must be"
+		if isLength {
+			what = "length must be"
+		}
+		if rule.name == "min" && value < rule.bound {
+			return fmt.Sprintf("%s at least %s", what, rule.arg)
+		}
+		if rule.name == "max" && value > rule.bound {
+			return fmt.Sprintf("%s at most %s", what, rule.arg)
+		}
+
+	case "email":
+		if v.Kind() == reflect.String && !IsEmail(v.String()) {
+			return "must be a valid email"
+		}
+
+	case "oneof":
+		if !StringIsIn(fmt.Sprint(v.Interface()), rule.words) {
+			return "must be one of " + rule.arg
+		}
+
+	case "regexp":
+		if v.Kind() == reflect.String && !rule.reg.MatchString(v.String()) {
+			return "must match " + rule.arg
+		}
+	}
+
+	return ""
+}
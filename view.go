@@ -1,40 +1,258 @@
 package iron
 
 import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"log"
 	"net/http"
-	"text/template"
+	"path"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	texttemplate "text/template"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	VIEW_LAYOUT_DIR  = "layout"  // under SiteViewDir, see AssignLayoutView
+	VIEW_PARTIAL_DIR = "partial" // under SiteViewDir, parsed into every view
 )
 
+// viewTemplate is what html/template and text/template templates share.
+type viewTemplate interface {
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
 type View struct {
-	filenames []string
-	tmpl      *template.Template
+	layout      string // filename, "" when none
+	filenames   []string
+	isPlainText bool
+	tmpl        viewTemplate
 }
 
-func (p *Server) Render(path string, w http.ResponseWriter, r *http.Request, ViewData map[string]interface{}) {
-	w.Header().Add("Content-Type", "text/html;charset=utf-8")
-	w.Header().Add("Server", "iron")
+// parseView parses the files of view after the partials, so a view can
+// use them and redefine the blocks of its layout. html/template escapes
+// the output by context, text/template is used for plain text views.
+// p.viewMu is held by the caller.
+func (p *Server) parseView(path string, view *View) (viewTemplate, error) {
+	var partials, err = p.partialFilenames()
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	if view.layout != "" {
+		filenames = append(filenames, view.layout)
+	}
+	filenames = append(append(filenames, partials...), view.filenames...)
 
-	var tmpl *template.Template
+	var fsys = p.viewFS()
+	if view.isPlainText {
+		return texttemplate.New(path).Delims("<?", "?>").Funcs(p.templateFuncs).ParseFS(fsys, filenames...)
+	}
+	return htmltemplate.New(path).Delims("<?", "?>").Funcs(p.templateFuncs).ParseFS(fsys, filenames...)
+}
 
+func (p *Server) partialFilenames() ([]string, error) {
+	var (
+		fsys         = p.viewFS()
+		entries, err = fs.ReadDir(fsys, VIEW_PARTIAL_DIR)
+		ret          []string
+	)
+	if err != nil {
+		if xerrors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		var filename = path.Join(VIEW_PARTIAL_DIR, entry.Name())
+		if info, err := fs.Stat(fsys, filename); err == nil && info.Mode().IsRegular() {
+			ret = append(ret, filename)
+		}
+	}
+	return ret, nil
+}
+
+func (p *Server) viewTemplate(path string) (viewTemplate, error) {
+	var view, ok = p.views[path]
+	if !ok {
+		return nil, xerrors.Errorf("%w, path:%s", ErrViewNotFound, path)
+	}
 	if p.Options.IsTMPLAutoRefresh {
-		tmpl = template.Must(template.New(path).Delims("<?", "?>").ParseFiles(p.views[path].filenames...))
-	} else {
-		if nil == p.views[path].tmpl {
-			p.views[path].tmpl = template.Must(template.New(path).Delims("<?", "?>").ParseFiles(p.views[path].filenames...))
+		p.viewMu.RLock()
+		defer p.viewMu.RUnlock()
+		return p.parseView(path, view)
+	}
+
+	p.viewMu.RLock()
+	var tmpl = view.tmpl
+	p.viewMu.RUnlock()
+	if tmpl != nil {
+		return tmpl, nil
+	}
+
+	p.viewMu.Lock()
+	defer p.viewMu.Unlock()
+	if nil == view.tmpl {
+		var tmpl, err = p.parseView(path, view)
+		if err != nil {
+			return nil, err
+		}
+		view.tmpl = tmpl
+	}
+	return view.tmpl, nil
+}
+
+// LoadViews parses every assigned view, so broken templates are reported
+// at startup rather than on their first request, Serve calls it first.
+func (p *Server) LoadViews() error {
+	var paths []string
+	for path := range p.views {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	p.viewMu.Lock()
+	defer p.viewMu.Unlock()
+	for _, path := range paths {
+		var tmpl, err = p.parseView(path, p.views[path])
+		if err != nil {
+			return xerrors.Errorf("load view failed, path:%s, err:%w", path, err)
+		}
+		if !p.Options.IsTMPLAutoRefresh {
+			p.views[path].tmpl = tmpl
 		}
-		tmpl = p.views[path].tmpl
 	}
+	return nil
+}
 
-	tmpl.ExecuteTemplate(w, "Frame", ViewData)
+const VIEW_BUFFER_POOL_MAX = 1 << 20 // larger buffers are not pooled
+
+var viewBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// Render renders the view at path with a 200, see RenderStatus.
+func (p *Server) Render(path string, w http.ResponseWriter, r *http.Request, ViewData map[string]interface{}) error {
+	return p.RenderStatus(http.StatusOK, path, w, r, ViewData)
 }
 
+// RenderStatus renders the view at path into a buffer, only once it
+// succeeded are the headers, Content-Length and status written to w.
+// Nothing is written when it returns an error.
+func (p *Server) RenderStatus(status int, path string, w http.ResponseWriter, r *http.Request, ViewData map[string]interface{}) error {
+	var buf = viewBufferPool.Get().(*bytes.Buffer)
+	defer putViewBuffer(buf)
+
+	if err := p.executeView(buf, path, ViewData); err != nil {
+		return err
+	}
+
+	if p.views[path].isPlainText {
+		w.Header().Set("Content-Type", "text/plain;charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/html;charset=utf-8")
+	}
+	w.Header().Set("Server", "iron")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	var _, err = w.Write(buf.Bytes())
+	return err
+}
+
+// RenderString renders the view at path and returns the output, for
+// mails and the like.
+func (p *Server) RenderString(path string, ViewData map[string]interface{}) (string, error) {
+	var buf = viewBufferPool.Get().(*bytes.Buffer)
+	defer putViewBuffer(buf)
+
+	if err := p.executeView(buf, path, ViewData); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (p *Server) executeView(buf *bytes.Buffer, path string, ViewData map[string]interface{}) error {
+	var tmpl, err = p.viewTemplate(path)
+	if err != nil {
+		return err
+	}
+	return tmpl.ExecuteTemplate(buf, "Frame", ViewData)
+}
+
+func putViewBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > VIEW_BUFFER_POOL_MAX {
+		return
+	}
+	buf.Reset()
+	viewBufferPool.Put(buf)
+}
+
+// renderError logs err and, while nothing has been written, answers 500
+// with the debug page in dev RunMode with Options.IsDebugPage, or a
+// generic error page.
+func (p *Server) renderError(w http.ResponseWriter, r *http.Request, path string, err error) {
+	log.Println("render view error, path:", path, "err:", err)
+
+	var ir = RequestFromContext(r.Context())
+	if rw, ok := w.(ResponseWriter); ir == nil || !ok || rw.IsHeaderWritten() {
+		return
+	}
+
+	var irCopy = *ir
+	irCopy.W = w
+	if p.Options.RunMode == "dev" && p.Options.IsDebugPage {
+		irCopy.RenderDebugPage(http.StatusInternalServerError, err, debug.Stack())
+		return
+	}
+	irCopy.RenderErrorPage(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), "")
+}
+
+// AssignView binds path to html view files, ViewData is escaped by
+// html/template, use template.HTML for trusted markup.
 func (p *Server) AssignView(path string, _viewFilenames ...string) {
+	p.assignView(path, "", false, _viewFilenames...)
+}
+
+// AssignLayoutView binds path to html view files rendered in the named
+// layout, the file SiteViewDir/layout/<layout>.html which defines "Frame"
+// and the blocks the view files may redefine.
+func (p *Server) AssignLayoutView(path, layout string, _viewFilenames ...string) {
+	p.assignView(path, layout, false, _viewFilenames...)
+}
+
+// AssignTextView binds path to plain text view files, rendered by
+// text/template without any escaping.
+func (p *Server) AssignTextView(path string, _viewFilenames ...string) {
+	p.assignView(path, "", true, _viewFilenames...)
+}
+
+func (p *Server) assignView(path, layout string, isPlainText bool, _viewFilenames ...string) {
+	// names are relative to viewFS
+	if layout != "" {
+		layout = VIEW_LAYOUT_DIR + "/" + layout + ".html"
+	}
 	viewFilenames := []string{}
 	for _, v := range _viewFilenames {
 		if "" == v {
 			break
 		}
-		viewFilenames = append(viewFilenames, p.Options.SiteViewDir+"/"+v)
+		viewFilenames = append(viewFilenames, v)
+	}
+	p.views[path] = &View{layout, viewFilenames, isPlainText, nil}
+}
+
+// AddTemplateFunc registers fn as name for every view, the views already
+// parsed are parsed again on their next render.
+func (p *Server) AddTemplateFunc(name string, fn interface{}) {
+	p.viewMu.Lock()
+	defer p.viewMu.Unlock()
+	p.templateFuncs[name] = fn
+	for _, view := range p.views {
+		view.tmpl = nil
 	}
-	p.views[path] = &View{viewFilenames, nil}
 }
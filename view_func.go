@@ -0,0 +1,95 @@
+package iron
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const PAGINATION_WINDOW = 4 // pages listed around the current one
+
+// Pagination is what the "pagination" template func gives to views.
+type Pagination struct {
+	Page    int
+	Pages   int
+	Count   int
+	PerPage int
+	Prev    int // 0 when on the first page
+	Next    int // 0 when on the last page
+	Numbers []int
+}
+
+// NewPagination computes the pages of count items by perPage, page is
+// made safe and kept within the pages.
+func NewPagination(page, count, perPage int) Pagination {
+	var ret = Pagination{Page: SafePage(page), Count: count, PerPage: perPage}
+	if perPage > 0 {
+		ret.Pages = CalculatePages(count, perPage)
+	}
+	if ret.Pages > 0 && ret.Page > ret.Pages {
+		ret.Page = ret.Pages
+	}
+	if ret.Page > 1 {
+		ret.Prev = ret.Page - 1
+	}
+	if ret.Page < ret.Pages {
+		ret.Next = ret.Page + 1
+	}
+	for i := ret.Page - PAGINATION_WINDOW; i <= ret.Page+PAGINATION_WINDOW; i++ {
+		if i >= 1 && i <= ret.Pages {
+			ret.Numbers = append(ret.Numbers, i)
+		}
+	}
+	return ret
+}
+
+// initTemplateFuncs registers the template funcs every view gets:
+//
+//	url "/user" "id" 3          -> /user?id=3
+//	asset "css/site.css"        -> /static/css/site.3f2a9c1b0d4e.css
+//	.CreatedAt | date "2006-01-02"
+//	pagination .Page .Count 20  -> Pagination
+func (p *Server) initTemplateFuncs() {
+	p.AddTemplateFunc("url", templateUrl)
+	p.AddTemplateFunc("asset", p.AssetUrl)
+	p.AddTemplateFunc("date", templateDate)
+	p.AddTemplateFunc("pagination", NewPagination)
+}
+
+func templateUrl(urlPath string, pairs ...interface{}) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", xerrors.New("url: odd number of query arguments.")
+	}
+	if len(pairs) == 0 {
+		return urlPath, nil
+	}
+	var query = url.Values{}
+	for i := 0; i < len(pairs); i += 2 {
+		query.Add(fmt.Sprint(pairs[i]), fmt.Sprint(pairs[i+1]))
+	}
+	if strings.Contains(urlPath, "?") {
+		return urlPath + "&" + query.Encode(), nil
+	}
+	return urlPath + "?" + query.Encode(), nil
+}
+
+// templateDate formats a time.Time or unix seconds.
+func templateDate(layout string, t interface{}) (string, error) {
+	switch v := t.(type) {
+	case time.Time:
+		return v.Format(layout), nil
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		return v.Format(layout), nil
+	case int64:
+		return time.Unix(v, 0).Format(layout), nil
+	case int:
+		return time.Unix(int64(v), 0).Format(layout), nil
+	}
+	return "", xerrors.Errorf("date: unsupported type %T.", t)
+}
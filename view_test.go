@@ -0,0 +1,204 @@
+package iron
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestViewEscape(t *testing.T) {
+	var viewDir, err = ioutil.TempDir("", "iron-view")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(viewDir)
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(viewDir, "page.html"),
+		[]byte(`<? define "Frame" ?><a href="<? .Link ?>"><? .Name | shout ?></a><? end ?>`), 0644))
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "dev", SiteViewDir: viewDir}))
+	server.AddTemplateFunc("shout", strings.ToUpper)
+	server.AssignView("html", "page.html")
+	server.AssignTextView("text", "page.html")
+	for _, path := range []string{"html", "text"} {
+		var path = path
+		server.Router("/"+path, func(ir *Request) {
+			ir.ViewData["Link"] = "javascript:alert(1)"
+			ir.ViewData["Name"] = "<b>iron</b>"
+			ir.Render(path)
+		})
+	}
+
+	var w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/html", nil))
+	assert.Equal(t, "text/html;charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `<a href="#ZgotmplZ">&lt;B&gt;IRON&lt;/B&gt;</a>`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/text", nil))
+	assert.Equal(t, "text/plain;charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `<a href="javascript:alert(1)"><B>IRON</B></a>`, w.Body.String())
+}
+
+func TestViewLayout(t *testing.T) {
+	var logWriter = log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(logWriter)
+
+	var viewDir, err = ioutil.TempDir("", "iron-view")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(viewDir)
+	for filename, content := range map[string]string{
+		"layout/main.html":  `<? define "Frame" ?><title><? block "title" . ?>iron<? end ?></title><? template "nav" . ?><? block "content" . ?><? end ?><? end ?>`,
+		"partial/nav.html":  `<? define "nav" ?><nav><a href="<? url "/list" "q" "a b" ?>">list</a></nav><? end ?>`,
+		"user/show.html":    `<? define "title" ?>user<? end ?><? define "content" ?><? .CreatedAt | date "2006-01-02" ?> <? asset "site.css" ?><? with pagination 3 95 10 ?> <? .Prev ?>/<? .Next ?>/<? .Pages ?> <? .Numbers ?><? end ?><? end ?>`,
+		"user/broken.html":  `<? define "content" ?><? if ?><? end ?>`,
+		"user/default.html": `<? define "content" ?>default<? end ?>`,
+	} {
+		AssertErrIsNil(os.MkdirAll(filepath.Dir(filepath.Join(viewDir, filename)), 0755))
+		AssertErrIsNil(ioutil.WriteFile(filepath.Join(viewDir, filename), []byte(content), 0644))
+	}
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "proc", SiteViewDir: viewDir}))
+	server.AssignLayoutView("show", "main", "user/show.html")
+	server.AssignLayoutView("default", "main", "user/default.html")
+	server.Router("/show", func(ir *Request) {
+		ir.ViewData["CreatedAt"] = time.Date(2020, 5, 17, 0, 0, 0, 0, time.UTC)
+		ir.Render("show")
+	})
+	server.Router("/default", func(ir *Request) {
+		ir.Render("default")
+	})
+	AssertErrIsNil(server.LoadViews())
+
+	var w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/show", nil))
+	assert.Equal(t, `<title>user</title><nav><a href="/list?q=a&#43;b">list</a></nav>`+
+		`2020-05-17 /static/site.css 2/4/10 [1 2 3 4 5 6 7]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/default", nil))
+	assert.Equal(t, `<title>iron</title><nav><a href="/list?q=a&#43;b">list</a></nav>default`, w.Body.String())
+
+	server.AssignLayoutView("broken", "main", "user/broken.html")
+	assert.NotNil(t, server.LoadViews())
+	server.Router("/broken", func(ir *Request) {
+		ir.Render("broken")
+	})
+	server.Router("/missing", func(ir *Request) {
+		ir.Render("missing")
+	})
+	for _, path := range []string{"/broken", "/missing"} {
+		w = httptest.NewRecorder()
+		server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	var p = NewPagination(0, 0, 10)
+	assert.Equal(t, 1, p.Page)
+	assert.Equal(t, 0, p.Pages)
+	assert.Equal(t, 0, p.Next)
+
+	p = NewPagination(12, 95, 10)
+	assert.Equal(t, 10, p.Page)
+	assert.Equal(t, 9, p.Prev)
+	assert.Equal(t, 0, p.Next)
+	assert.Equal(t, []int{6, 7, 8, 9, 10}, p.Numbers)
+}
+
+func TestRenderBuffered(t *testing.T) {
+	var logWriter = log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(logWriter)
+
+	var viewDir, err = ioutil.TempDir("", "iron-view")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(viewDir)
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(viewDir, "ok.html"),
+		[]byte(`<? define "Frame" ?>hello <? .Name ?><? end ?>`), 0644))
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(viewDir, "fail.html"),
+		[]byte(`<? define "Frame" ?>half written<? date "2006" "now" ?><? end ?>`), 0644))
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "proc", SiteViewDir: viewDir}))
+	server.AssignView("ok", "ok.html")
+	server.AssignView("fail", "fail.html")
+
+	var renderErr error
+	server.Router("/ok", func(ir *Request) {
+		ir.ViewData["Name"] = "iron"
+		renderErr = ir.RenderStatus(http.StatusNotFound, "ok")
+	})
+	server.Router("/fail", func(ir *Request) {
+		renderErr = ir.Render("fail")
+	})
+
+	var w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	assert.Nil(t, renderErr)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Equal(t, "hello iron", w.Body.String())
+
+	w = httptest.NewRecorder()
+	server.httpMux.ServeHTTP(w, httptest.NewRequest("GET", "/fail", nil))
+	assert.NotNil(t, renderErr)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.False(t, strings.Contains(w.Body.String(), "half written"))
+
+	var str string
+	str, err = server.RenderString("ok", map[string]interface{}{"Name": "mail"})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello mail", str)
+	_, err = server.RenderString("fail", nil)
+	assert.NotNil(t, err)
+}
+
+func TestViewConcurrentParse(t *testing.T) {
+	var viewDir, err = ioutil.TempDir("", "iron-view")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(viewDir)
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(viewDir, "page.html"),
+		[]byte(`<? define "Frame" ?><? "iron" | shout ?><? end ?>`), 0644))
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{RunMode: "proc", SiteViewDir: viewDir}))
+	server.AddTemplateFunc("shout", strings.ToUpper)
+	server.AssignView("page", "page.html")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var w = httptest.NewRecorder()
+			assert.NoError(t, server.Render("page", w, httptest.NewRequest("GET", "/", nil), nil))
+			assert.Equal(t, "IRON", w.Body.String())
+		}()
+	}
+	server.AddTemplateFunc("shout", strings.ToUpper)
+	wg.Wait()
+}
+
+func TestServeLoadViewsFailed(t *testing.T) {
+	var viewDir, err = ioutil.TempDir("", "iron-view")
+	AssertErrIsNil(err)
+	defer os.RemoveAll(viewDir)
+	AssertErrIsNil(ioutil.WriteFile(filepath.Join(viewDir, "broken.html"),
+		[]byte("<? define \"Frame\" ?><? if ?><? end ?>"), 0644))
+
+	var server Server
+	AssertErrIsNil(server.Init(Options{ServeType: "server", ListenStr: "127.0.0.1:17211", SiteViewDir: viewDir}))
+	server.AssignView("broken", "broken.html")
+	assert.Error(t, server.Serve())
+}